@@ -51,7 +51,7 @@ func (a *App) FastForward(rev int64) (app *App) {
 func (a *App) Register() (app *App, err error) {
 	exists, _, err := a.conn.Exists(a.Path.Dir)
 	if err != nil {
-		return nil, fmt.Errorf("application '%s' is already registered", a.Name)
+		return nil, err
 	}
 	if exists {
 		return nil, ErrKeyConflict
@@ -61,35 +61,29 @@ func (a *App) Register() (app *App, err error) {
 		a.DeployType = DEPLOY_LXC
 	}
 
-	attrs := &File{
-		Snapshot: a.Snapshot,
-		Codec:    new(JSONCodec),
-		Path:     a.Path.Prefix("attrs"),
-		Value: map[string]interface{}{
-			"repo-url":    a.RepoUrl,
-			"stack":       string(a.Stack),
-			"deploy-type": a.DeployType,
-		},
-	}
-
-	_, err = attrs.Create()
+	attrs, err := new(JSONCodec).Encode(map[string]interface{}{
+		"repo-url":    a.RepoUrl,
+		"stack":       string(a.Stack),
+		"deploy-type": a.DeployType,
+	})
 	if err != nil {
 		return
 	}
 
+	txn := a.Snapshot.Txn()
+	txn.SetBytes(a.Path.Prefix("attrs"), attrs)
+
 	for k, v := range a.Env {
-		_, err = a.SetEnvironmentVar(k, v)
-		if err != nil {
-			return
-		}
+		txn.Set(a.Path.Prefix("env", strings.Replace(k, "_", "-", -1)), v)
 	}
+	txn.Set(a.Path.Prefix("registered"), time.Now().UTC().String())
 
-	rev, err := a.Set("registered", time.Now().UTC().String())
+	s, err := txn.Commit()
 	if err != nil {
 		return
 	}
 
-	app = a.FastForward(rev)
+	app = a.FastForward(s.Rev)
 
 	return
 }
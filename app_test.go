@@ -10,7 +10,7 @@ import (
 )
 
 func appSetup(name string) (app *App) {
-	s, err := Dial(DEFAULT_ADDR, DEFAULT_ROOT)
+	s, err := testDial(DEFAULT_ROOT)
 	if err != nil {
 		panic(err)
 	}
@@ -223,7 +223,7 @@ func TestApps(t *testing.T) {
 	}
 	app = app.FastForward(-1)
 
-	s, _ := Dial(DEFAULT_ADDR, DEFAULT_ROOT)
+	s, _ := testDial(DEFAULT_ROOT)
 
 	apps, err := Apps(s)
 	if err != nil {
@@ -0,0 +1,155 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Backend is the interface implemented by the revisioned stores visor
+// can run on top of. It follows the semantics of doozerd: every
+// mutation advances a global revision, a file revision of 0 means the
+// file doesn't exist and directories are reported with negative
+// revisions. Backends must report missing files and directories
+// with an *Error wrapping ErrNoEnt.
+type Backend interface {
+	// Get returns the value and revision of the file at path, at the
+	// given revision or the latest one if rev is nil.
+	Get(path string, rev *int64) (value []byte, filerev int64, err error)
+
+	// Set writes value to path if the file's revision is <= rev,
+	// a rev of -1 overwrites unconditionally.
+	Set(path string, rev int64, value []byte) (newrev int64, err error)
+
+	// Del deletes the file at path if its revision is <= rev.
+	Del(path string, rev int64) error
+
+	// Stat returns the length and revision of the file at path.
+	Stat(path string, rev *int64) (len int, filerev int64, err error)
+
+	// Getdir returns the names of the entries in the directory at path.
+	Getdir(path string, rev int64, offset, limit int) (names []string, err error)
+
+	// Wait blocks until a file matching glob changes at a revision >= rev.
+	Wait(glob string, rev int64) (Change, error)
+
+	// Rev returns the latest revision.
+	Rev() (int64, error)
+
+	// Close releases the resources held by the backend.
+	Close()
+}
+
+// A BatchBackend is a Backend which can apply several mutations
+// atomically. Backends which don't implement it get a fallback
+// applying the mutations one by one and rolling them back on failure.
+type BatchBackend interface {
+	Backend
+
+	// Batch applies all mutations or none of them and returns
+	// the revision of the last one.
+	Batch(muts []Mutation) (newrev int64, err error)
+}
+
+// A ContextBackend is a Backend which can abort a pending Wait. For
+// backends which don't implement it, waits which were given up on
+// keep running until the next matching change.
+type ContextBackend interface {
+	Backend
+
+	// WaitContext is like Wait, but returns ctx.Err() once ctx is done.
+	WaitContext(ctx context.Context, glob string, rev int64) (Change, error)
+
+	// Waiter returns a Waiter for a series of waits, which return
+	// ctx.Err() once ctx is done. It holds what aborting the waits
+	// takes, such as a connection of its own, until it's closed.
+	Waiter(ctx context.Context) (Waiter, error)
+}
+
+// A Waiter waits for changes like (Backend).Wait, see (ContextBackend).Waiter.
+type Waiter interface {
+	Wait(glob string, rev int64) (Change, error)
+	Close()
+}
+
+// A Mutation is a single write or deletion as part of a batch.
+// Like with (Backend).Set, Rev is the revision the file is expected
+// to be at or below, -1 applies the mutation unconditionally.
+type Mutation struct {
+	Path  string
+	Rev   int64
+	Value []byte
+	Del   bool
+}
+
+// A BackendDialer opens a Backend for the given URI.
+type BackendDialer func(uri string) (Backend, error)
+
+// A Change represents a mutation of a single file, as returned
+// by (Backend).Wait.
+type Change struct {
+	Rev  int64
+	Path string
+	Body []byte
+	Flag int32
+}
+
+// Change flags, their values match the ones used by doozer.
+const (
+	ChangeSet int32 = 4
+	ChangeDel int32 = 8
+)
+
+// IsSet returns true if the file was written.
+func (c Change) IsSet() bool {
+	return c.Flag&ChangeSet > 0
+}
+
+// IsDel returns true if the file was deleted.
+func (c Change) IsDel() bool {
+	return c.Flag&ChangeDel > 0
+}
+
+var (
+	backendsMu sync.Mutex
+	backends   = map[string]BackendDialer{}
+)
+
+// RegisterBackend makes a Backend available for URIs with the given
+// scheme. Registering the same scheme twice panics.
+func RegisterBackend(scheme string, dial BackendDialer) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if dial == nil {
+		panic("visor: RegisterBackend dialer is nil")
+	}
+	if _, dup := backends[scheme]; dup {
+		panic("visor: RegisterBackend called twice for scheme " + scheme)
+	}
+	backends[scheme] = dial
+}
+
+// DialBackend opens the Backend registered for the scheme of uri.
+func DialBackend(uri string) (Backend, error) {
+	i := strings.Index(uri, ":")
+	if i < 1 {
+		return nil, fmt.Errorf("uri '%s' has no scheme", uri)
+	}
+	scheme := uri[:i]
+
+	backendsMu.Lock()
+	dial, ok := backends[scheme]
+	backendsMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no backend registered for scheme '%s'", scheme)
+	}
+	return dial(uri)
+}
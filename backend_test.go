@@ -0,0 +1,75 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"testing"
+)
+
+type revBackend struct {
+	Backend
+	rev int64
+}
+
+func (b *revBackend) Rev() (int64, error) {
+	return b.rev, nil
+}
+
+// Get finds nothing, so the schema check on dial passes.
+func (b *revBackend) Get(path string, rev *int64) ([]byte, int64, error) {
+	return nil, 0, nil
+}
+
+func init() {
+	RegisterBackend("backend-test", func(uri string) (Backend, error) {
+		return &revBackend{rev: 42}, nil
+	})
+}
+
+func TestBackendDialUriScheme(t *testing.T) {
+	s, err := DialUri("backend-test:?ca=nowhere", "/backend-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Rev != 42 {
+		t.Errorf("expected snapshot at rev 42, got %d", s.Rev)
+	}
+	if _, ok := s.conn.conn.(*revBackend); !ok {
+		t.Errorf("expected backend-test backend, got %T", s.conn.conn)
+	}
+}
+
+func TestBackendDialUriUnknownScheme(t *testing.T) {
+	_, err := DialUri("nobackend:?ca=localhost:8046", "/backend-test")
+	if err == nil {
+		t.Error("expected error for unregistered scheme")
+	}
+
+	_, err = DialUri("localhost", "/backend-test")
+	if err == nil {
+		t.Error("expected error for uri without scheme")
+	}
+}
+
+func TestBackendRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on duplicate registration")
+		}
+	}()
+	RegisterBackend("doozer", dialDoozerUri)
+}
+
+func TestChangeFlags(t *testing.T) {
+	c := Change{Flag: ChangeSet}
+	if !c.IsSet() || c.IsDel() {
+		t.Error("expected set change")
+	}
+	c = Change{Flag: ChangeDel}
+	if c.IsSet() || !c.IsDel() {
+		t.Error("expected del change")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+	"strconv"
+)
+
+var cmdDiff = &Command{
+	Name:      "diff",
+	Short:     "show changes between revisions",
+	UsageLine: "diff <rev1> <rev2>",
+	Long: `
+Diff shows what was added, removed or changed in the coordinator between
+the two revisions given, grouped by app, environment, scale, proctype,
+instance, service, endpoint and host.
+  `,
+}
+
+func init() {
+	cmdDiff.Run = runDiff
+}
+
+func runDiff(cmd *Command, args []string) {
+	if len(args) < 2 {
+		cmd.Flag.Usage()
+	}
+
+	s := cmdDiff.Snapshot
+	snapshots := make([]visor.Snapshot, 2)
+
+	for i := range snapshots {
+		rev, err := strconv.ParseInt(args[i], 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing revision %s\n", err.Error())
+			os.Exit(2)
+		}
+		if snapshots[i], err = s.At(rev); err != nil {
+			fmt.Fprintf(os.Stderr, "Error invalid revision %s\n", err.Error())
+			os.Exit(2)
+		}
+	}
+
+	entries, err := visor.Diff(snapshots[0], snapshots[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error comparing revisions %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	var kind, object string
+
+	for i, e := range entries {
+		if i == 0 || e.Kind != kind || e.Object != object {
+			kind, object = e.Kind, e.Object
+			fmt.Fprintf(os.Stdout, "%s %s\n", kind, object)
+		}
+
+		switch e.Op {
+		case visor.DiffAdded:
+			fmt.Fprintf(os.Stdout, "  + %s: %s\n", e.Key, e.New)
+		case visor.DiffRemoved:
+			fmt.Fprintf(os.Stdout, "  - %s: %s\n", e.Key, e.Old)
+		case visor.DiffChanged:
+			fmt.Fprintf(os.Stdout, "  ~ %s: %s -> %s\n", e.Key, e.Old, e.New)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdDump = &Command{
+	Name:      "dump",
+	Short:     "dump coordinator state",
+	UsageLine: "dump [<file>]",
+	Long: `
+Dump writes everything under the root at the latest revision as JSON
+to the file given, or to stdout. The dump can be restored with load.
+  `,
+}
+
+func init() {
+	cmdDump.Run = runDump
+}
+
+func runDump(cmd *Command, args []string) {
+	s := cmdDump.Snapshot
+	out := os.Stdout
+
+	d, err := visor.DumpSnapshot(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error dumping %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	if len(args) > 0 {
+		out, err = os.Create(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating file %s\n", err.Error())
+			os.Exit(2)
+		}
+		defer out.Close()
+	}
+
+	err = visor.WriteDump(out, d)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing dump %s\n", err.Error())
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+	"time"
+)
+
+var cmdFsck = &Command{
+	Name:      "fsck",
+	Short:     "check coordinator consistency",
+	UsageLine: "fsck [-repair] [-claim-timeout <duration>]",
+	Long: `
+Fsck checks the coordinator tree for inconsistencies, such as instance
+links without an instance, scale factors for unregistered proctypes, app
+attrs with missing keys and tickets stuck in the claimed state.
+
+Options:
+  -repair         fix the problems which can be fixed safely
+  -claim-timeout  report tickets claimed longer than this as stuck (1h)
+  `,
+}
+
+var fsckRepair = cmdFsck.Flag.Bool("repair", false, "")
+var fsckClaimTimeout = cmdFsck.Flag.Duration("claim-timeout", time.Hour, "")
+
+func init() {
+	cmdFsck.Run = runFsck
+}
+
+func runFsck(cmd *Command, args []string) {
+	s := cmdFsck.Snapshot
+
+	problems, err := visor.Fsck(s, *fsckClaimTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error checking coordinator %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	for _, p := range problems {
+		fmt.Fprintf(os.Stdout, "%s\n", p)
+	}
+
+	if *fsckRepair {
+		_, repaired, err := visor.FsckRepair(s, problems)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error repairing %s\n", err.Error())
+			os.Exit(2)
+		}
+		for _, p := range repaired {
+			fmt.Fprintf(os.Stdout, "repaired %s\n", p.Path)
+		}
+		if len(repaired) == len(problems) {
+			return
+		}
+	}
+
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdHostDescribe = &Command{
+	Name:      "host-describe",
+	Short:     "shows host info",
+	UsageLine: "host-describe <name>",
+	Long: `
+Host-describe returns meta information for the host given.
+  `,
+}
+
+func init() {
+	cmdHostDescribe.Run = runHostDescribe
+}
+
+func runHostDescribe(cmd *Command, args []string) {
+	if len(args) < 1 {
+		cmd.Flag.Usage()
+	}
+
+	s := cmdHostDescribe.Snapshot
+
+	host, err := visor.GetHost(s, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching host %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	fmt.Fprintf(os.Stdout, "name: %s\n", host.Name)
+	fmt.Fprintf(os.Stdout, "slots: %d\n", host.Slots)
+	fmt.Fprintf(os.Stdout, "memory: %d\n", host.Memory)
+	fmt.Fprintf(os.Stdout, "labels: %s\n", host.LabelString())
+
+	if t, err := host.Registered(); err == nil {
+		fmt.Fprintf(os.Stdout, "registered: %s\n", t)
+	}
+	if t, err := host.LastHeartbeat(); err == nil {
+		fmt.Fprintf(os.Stdout, "heartbeat: %s\n", t)
+	}
+}
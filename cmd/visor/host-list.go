@@ -0,0 +1,39 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdHostList = &Command{
+	Name:      "host-list",
+	Short:     "lists hosts",
+	UsageLine: "host-list",
+	Long: `
+Host-list returns all registered hosts with their slots, memory and labels.
+  `,
+}
+
+func init() {
+	cmdHostList.Run = runHostList
+}
+
+func runHostList(cmd *Command, args []string) {
+	s := cmdHostList.Snapshot
+
+	hosts, err := visor.Hosts(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching hosts %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	for _, h := range hosts {
+		fmt.Fprintf(os.Stdout, "%s %d %d %s\n", h.Name, h.Slots, h.Memory, h.LabelString())
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+	"strings"
+)
+
+var cmdHostRegister = &Command{
+	Name:      "host-register",
+	Short:     "add host to the global registry",
+	UsageLine: "host-register [options] <name>",
+	Long: `
+Host-register adds hosts to the global registry. Names consist of letters,
+digits, dots and dashes.
+
+Options:
+  -slots   number of instances the host can run (0)
+  -memory  memory of the host in megabytes (0)
+  -labels  comma separated key=value pairs (zone=eu,disk=ssd)
+  `,
+}
+
+var hostSlots = cmdHostRegister.Flag.Int("slots", 0, "")
+var hostMemory = cmdHostRegister.Flag.Int("memory", 0, "")
+var hostLabels = cmdHostRegister.Flag.String("labels", "", "")
+
+func init() {
+	cmdHostRegister.Run = runHostRegister
+}
+
+func runHostRegister(cmd *Command, args []string) {
+	if len(args) < 1 {
+		cmd.Flag.Usage()
+	}
+
+	host := visor.NewHost(args[0], *hostSlots, *hostMemory, cmdHostRegister.Snapshot)
+
+	labels, err := parseLabels(*hostLabels)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing labels %s\n", err.Error())
+		os.Exit(2)
+	}
+	host.Labels = labels
+
+	_, err = host.Register()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error registering host %s\n", err.Error())
+		os.Exit(2)
+	}
+}
+
+// parseLabels parses comma separated key=value pairs.
+func parseLabels(str string) (labels map[string]string, err error) {
+	labels = map[string]string{}
+
+	for _, pair := range strings.Split(str, ",") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid label '%s'", pair)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return
+}
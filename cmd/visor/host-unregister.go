@@ -0,0 +1,45 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdHostUnregister = &Command{
+	Name:      "host-unregister",
+	Short:     "remove host from the global registry",
+	UsageLine: "host-unregister <name>",
+	Long: `
+Host-unregister removes hosts from the global registry.
+  `,
+}
+
+func init() {
+	cmdHostUnregister.Run = runHostUnregister
+}
+
+func runHostUnregister(cmd *Command, args []string) {
+	if len(args) < 1 {
+		cmd.Flag.Usage()
+	}
+
+	s := cmdHostUnregister.Snapshot
+
+	host, err := visor.GetHost(s, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching host %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	err = host.Unregister()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error unregistering host %s\n", err.Error())
+		os.Exit(2)
+	}
+}
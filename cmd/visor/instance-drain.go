@@ -0,0 +1,48 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdInstanceDrain = &Command{
+	Name:      "instance-drain",
+	Short:     "drain instance",
+	UsageLine: "instance-drain <instance>",
+	Long: `
+Instance-drain creates a ticket to stop the instance given, after it stopped
+taking traffic. If the instance's hostname is known, only that host can claim
+the ticket. It prints the ticket id.
+  `,
+}
+
+func init() {
+	cmdInstanceDrain.Run = runInstanceDrain
+}
+
+func runInstanceDrain(cmd *Command, args []string) {
+	if len(args) < 1 {
+		cmd.Flag.Usage()
+	}
+
+	s := cmdInstanceDrain.Snapshot
+
+	ins, err := visor.GetInstance(s, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching instance %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	t, err := visor.CreateInstanceTicket(ins, visor.OpDrain, s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating ticket %s\n", err.Error())
+		os.Exit(2)
+	}
+	fmt.Fprintf(os.Stdout, "%d\n", t.Id)
+}
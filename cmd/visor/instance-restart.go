@@ -0,0 +1,48 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdInstanceRestart = &Command{
+	Name:      "instance-restart",
+	Short:     "restart instance",
+	UsageLine: "instance-restart <instance>",
+	Long: `
+Instance-restart creates a ticket to restart the instance given. If the
+instance's hostname is known, only that host can claim the ticket. It prints
+the ticket id.
+  `,
+}
+
+func init() {
+	cmdInstanceRestart.Run = runInstanceRestart
+}
+
+func runInstanceRestart(cmd *Command, args []string) {
+	if len(args) < 1 {
+		cmd.Flag.Usage()
+	}
+
+	s := cmdInstanceRestart.Snapshot
+
+	ins, err := visor.GetInstance(s, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching instance %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	t, err := visor.CreateInstanceTicket(ins, visor.OpRestart, s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating ticket %s\n", err.Error())
+		os.Exit(2)
+	}
+	fmt.Fprintf(os.Stdout, "%d\n", t.Id)
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdInstanceSignal = &Command{
+	Name:      "instance-signal",
+	Short:     "send signal to instance",
+	UsageLine: "instance-signal <instance> <signal>",
+	Long: `
+Instance-signal creates a ticket to send the signal given, such as HUP, to
+the instance given. If the instance's hostname is known, only that host can
+claim the ticket. It prints the ticket id.
+  `,
+}
+
+func init() {
+	cmdInstanceSignal.Run = runInstanceSignal
+}
+
+func runInstanceSignal(cmd *Command, args []string) {
+	if len(args) < 2 {
+		cmd.Flag.Usage()
+	}
+
+	s := cmdInstanceSignal.Snapshot
+
+	ins, err := visor.GetInstance(s, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching instance %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	t, err := visor.CreateSignalTicket(ins, args[1], s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating ticket %s\n", err.Error())
+		os.Exit(2)
+	}
+	fmt.Fprintf(os.Stdout, "%d\n", t.Id)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdInstanceState = &Command{
+	Name:      "instance-state",
+	Short:     "change instance state",
+	UsageLine: "instance-state [-force] <instance> <state>",
+	Long: `
+Instance-state changes the state of the instance given, if the instance
+may change from its current state to it.
+
+Options:
+  -force  change the state regardless of the current state
+  `,
+}
+
+var instanceStateForce = cmdInstanceState.Flag.Bool("force", false, "")
+
+func init() {
+	cmdInstanceState.Run = runInstanceState
+}
+
+func runInstanceState(cmd *Command, args []string) {
+	if len(args) < 2 {
+		cmd.Flag.Usage()
+	}
+
+	s := cmdInstanceState.Snapshot
+	state := visor.State(args[1])
+
+	ins, err := visor.GetInstance(s, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching instance %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	if *instanceStateForce {
+		_, err = ins.ForceState(state)
+	} else {
+		_, err = ins.UpdateState(state)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error changing state %s\n", err.Error())
+		os.Exit(2)
+	}
+}
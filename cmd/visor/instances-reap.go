@@ -0,0 +1,46 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+	"time"
+)
+
+var cmdInstancesReap = &Command{
+	Name:      "instances-reap",
+	Short:     "mark silent instances dead",
+	UsageLine: "instances-reap [-ttl <duration>]",
+	Long: `
+Instances-reap marks initial and started instances as dead, if their last
+heartbeat is older than the ttl given. Instances which never sent a
+heartbeat are left alone.
+
+Options:
+  -ttl  maximum age of the last heartbeat (1m)
+  `,
+}
+
+var reapTtl = cmdInstancesReap.Flag.Duration("ttl", time.Minute, "")
+
+func init() {
+	cmdInstancesReap.Run = runInstancesReap
+}
+
+func runInstancesReap(cmd *Command, args []string) {
+	s := cmdInstancesReap.Snapshot
+
+	reaped, err := visor.ReapInstances(s, *reapTtl)
+	for _, i := range reaped {
+		fmt.Fprintf(os.Stdout, "%s %s\n", i.Name, i.LogString())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reaping instances %s\n", err.Error())
+		os.Exit(2)
+	}
+}
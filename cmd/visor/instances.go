@@ -0,0 +1,64 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdInstances = &Command{
+	Name:      "instances",
+	Short:     "find instances",
+	UsageLine: "instances [-app <app>] [-rev <rev>] [-proc <proc>] [-state <state>] [-host <host>] [-port <port>]",
+	Long: `
+Instances returns the instances of all applications matching the options
+given, and their state.
+
+Options:
+  -app    name of the application
+  -rev    name of the revision
+  -proc   name of the proctype
+  -state  state, such as started or failed
+  -host   address or hostname of the host
+  -port   port
+  `,
+}
+
+var instancesApp = cmdInstances.Flag.String("app", "", "")
+var instancesRev = cmdInstances.Flag.String("rev", "", "")
+var instancesProc = cmdInstances.Flag.String("proc", "", "")
+var instancesState = cmdInstances.Flag.String("state", "", "")
+var instancesHost = cmdInstances.Flag.String("host", "", "")
+var instancesPort = cmdInstances.Flag.Int("port", 0, "")
+
+func init() {
+	cmdInstances.Run = runInstances
+}
+
+func runInstances(cmd *Command, args []string) {
+	s := cmdInstances.Snapshot
+
+	filter := visor.InstanceFilter{
+		App:      *instancesApp,
+		Revision: *instancesRev,
+		ProcType: visor.ProcessName(*instancesProc),
+		State:    visor.State(*instancesState),
+		Host:     *instancesHost,
+		Port:     *instancesPort,
+	}
+
+	ins, err := visor.Instances(s, filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching instances %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	for _, i := range ins {
+		fmt.Fprintf(os.Stdout, "%s %s %s %s %s %s %d %s\n", i.Name, i.ServiceName, i.AppName, i.ProcessName, i.RevisionName, i.Host, i.Port, i.State)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdLoad = &Command{
+	Name:      "load",
+	Short:     "restore coordinator state",
+	UsageLine: "load [-apps-only] [-exclude-tickets] [-exclude-instances] [<file>]",
+	Long: `
+Load restores a dump written by dump from the file given, or from stdin.
+The root must be empty.
+
+Options:
+  -apps-only          only restore apps, their revisions and proctypes
+  -exclude-tickets    don't restore tickets
+  -exclude-instances  don't restore instances
+  `,
+}
+
+var loadAppsOnly = cmdLoad.Flag.Bool("apps-only", false, "")
+var loadExcludeTickets = cmdLoad.Flag.Bool("exclude-tickets", false, "")
+var loadExcludeInstances = cmdLoad.Flag.Bool("exclude-instances", false, "")
+
+func init() {
+	cmdLoad.Run = runLoad
+}
+
+func runLoad(cmd *Command, args []string) {
+	s := cmdLoad.Snapshot
+	in := os.Stdin
+	filters := []visor.DumpFilter{}
+
+	if len(args) > 0 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening file %s\n", err.Error())
+			os.Exit(2)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	if *loadAppsOnly {
+		filters = append(filters, visor.AppsOnly)
+	}
+	if *loadExcludeTickets {
+		filters = append(filters, visor.ExcludeTickets)
+	}
+	if *loadExcludeInstances {
+		filters = append(filters, visor.ExcludeInstances)
+	}
+
+	d, err := visor.ReadDump(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading dump %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	_, err = visor.Load(s, d, filters...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading dump %s\n", err.Error())
+		os.Exit(2)
+	}
+}
@@ -55,7 +55,22 @@ var commands = []*Command{
 	cmdAppRevisions,
 	cmdAppServices,
 	cmdAppUnregister,
+	cmdDiff,
+	cmdDump,
+	cmdFsck,
+	cmdHostDescribe,
+	cmdHostList,
+	cmdHostRegister,
+	cmdHostUnregister,
 	cmdInit,
+	cmdInstanceDrain,
+	cmdInstanceRestart,
+	cmdInstanceSignal,
+	cmdInstanceState,
+	cmdInstances,
+	cmdInstancesReap,
+	cmdLoad,
+	cmdMigrate,
 	cmdProcRegister,
 	cmdProcUnregister,
 	cmdRevDescribe,
@@ -63,6 +78,14 @@ var commands = []*Command{
 	cmdRevRegister,
 	cmdRevUnregister,
 	cmdScale,
+	cmdTicketCancel,
+	cmdTicketDescribe,
+	cmdTicketList,
+	cmdTicketRetry,
+	cmdTicketWait,
+	cmdTicketsDead,
+	cmdTicketsGc,
+	cmdTicketsSweep,
 }
 
 func main() {
@@ -0,0 +1,63 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdMigrate = &Command{
+	Name:      "migrate",
+	Short:     "upgrade coordinator schema",
+	UsageLine: "migrate [-dry-run]",
+	Long: `
+Migrate upgrades the coordinator tree to the schema version supported
+by this client, applying the pending migrations in order.
+
+Options:
+  -dry-run  only list the pending migrations
+  `,
+}
+
+var migrateDryRun = cmdMigrate.Flag.Bool("dry-run", false, "")
+
+func init() {
+	cmdMigrate.Run = runMigrate
+}
+
+func runMigrate(cmd *Command, args []string) {
+	s := cmdMigrate.Snapshot
+
+	version, err := visor.SchemaVersion(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching schema version %s\n", err.Error())
+		os.Exit(2)
+	}
+	fmt.Fprintf(os.Stdout, "schema version: %d\n", version)
+
+	if *migrateDryRun {
+		pending, err := visor.PendingMigrations(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching migrations %s\n", err.Error())
+			os.Exit(2)
+		}
+		for _, m := range pending {
+			fmt.Fprintf(os.Stdout, "pending %d: %s\n", m.Version, m.Description)
+		}
+		return
+	}
+
+	_, applied, err := visor.Migrate(s)
+	for _, m := range applied {
+		fmt.Fprintf(os.Stdout, "applied %d: %s\n", m.Version, m.Description)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error migrating %s\n", err.Error())
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+	"strconv"
+)
+
+var cmdTicketCancel = &Command{
+	Name:      "ticket-cancel",
+	Short:     "cancel unclaimed tickets",
+	UsageLine: "ticket-cancel <id>...",
+	Long: `
+Ticket-cancel withdraws unclaimed tickets, so that no host claims them.
+Tickets which are claimed or finished can't be cancelled.
+  `,
+}
+
+func init() {
+	cmdTicketCancel.Run = runTicketCancel
+}
+
+func runTicketCancel(cmd *Command, args []string) {
+	if len(args) < 1 {
+		cmd.Flag.Usage()
+	}
+
+	s := cmdTicketCancel.Snapshot
+
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing ticket id %s\n", err.Error())
+			os.Exit(2)
+		}
+
+		t, err := visor.GetTicket(s, id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching ticket %s\n", err.Error())
+			os.Exit(2)
+		}
+
+		t, err = t.Cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error cancelling ticket %s\n", err.Error())
+			os.Exit(2)
+		}
+		s = t.Snapshot
+	}
+}
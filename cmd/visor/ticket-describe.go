@@ -0,0 +1,111 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var cmdTicketDescribe = &Command{
+	Name:      "ticket-describe",
+	Short:     "shows ticket info",
+	UsageLine: "ticket-describe <id>",
+	Long: `
+Ticket-describe returns meta information for the ticket given, including
+its result and the timeline of its status changes.
+  `,
+}
+
+func init() {
+	cmdTicketDescribe.Run = runTicketDescribe
+}
+
+func runTicketDescribe(cmd *Command, args []string) {
+	if len(args) < 1 {
+		cmd.Flag.Usage()
+	}
+
+	s := cmdTicketDescribe.Snapshot
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing ticket id %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	t, err := visor.GetTicket(s, id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching ticket %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	fmt.Fprintf(os.Stdout, "id: %d\n", t.Id)
+	fmt.Fprintf(os.Stdout, "app: %s\n", t.AppName)
+	fmt.Fprintf(os.Stdout, "rev: %s\n", t.RevisionName)
+	fmt.Fprintf(os.Stdout, "proc: %s\n", t.ProcessName)
+	fmt.Fprintf(os.Stdout, "op: %s\n", t.Op)
+	if t.Op.TargetsInstance() {
+		fmt.Fprintf(os.Stdout, "instance: %s\n", t.InstanceId)
+	}
+	if t.Op == visor.OpSignal {
+		fmt.Fprintf(os.Stdout, "signal: %s\n", t.Signal)
+	}
+	fmt.Fprintf(os.Stdout, "status: %s\n", t.Status)
+
+	if p := t.Placement; p != nil {
+		placement := []string{}
+		if p.Host != "" {
+			placement = append(placement, "host="+p.Host)
+		}
+		for k, v := range p.Labels {
+			placement = append(placement, fmt.Sprintf("label:%s=%s", k, v))
+		}
+		if p.AntiAffinity {
+			placement = append(placement, "anti-affinity")
+		}
+		fmt.Fprintf(os.Stdout, "placement: %s\n", strings.Join(placement, ","))
+	}
+	if claims, err := t.Claims(); err == nil && len(claims) > 0 {
+		fmt.Fprintf(os.Stdout, "claims: %s\n", strings.Join(claims, ","))
+	}
+	fmt.Fprintf(os.Stdout, "attempts: %d\n", len(t.Attempts))
+	fmt.Fprintf(os.Stdout, "requeues: %d\n", t.Requeues)
+	if !t.Finished.IsZero() {
+		fmt.Fprintf(os.Stdout, "finished: %s\n", t.Finished)
+	}
+
+	if r := t.Result; r != nil {
+		if r.Message != "" {
+			fmt.Fprintf(os.Stdout, "result-message: %s\n", r.Message)
+		}
+		if r.ExitCode != nil {
+			fmt.Fprintf(os.Stdout, "result-exit-code: %d\n", *r.ExitCode)
+		}
+		if r.InstanceId != "" {
+			fmt.Fprintf(os.Stdout, "result-instance: %s\n", r.InstanceId)
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "timeline:\n")
+	for i, tr := range t.Timeline {
+		host := tr.Host
+		if host == "" {
+			host = "-"
+		}
+		d := "-"
+		if i+1 < len(t.Timeline) {
+			d = t.Timeline[i+1].Time.Sub(tr.Time).String()
+		} else if !tr.Status.Final() {
+			d = time.Since(tr.Time).String()
+		}
+		fmt.Fprintf(os.Stdout, "  %s %-9s %-24s %s\n", tr.Time.Format(time.RFC3339), tr.Status, host, d)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdTicketList = &Command{
+	Name:      "ticket-list",
+	Short:     "find tickets",
+	UsageLine: "ticket-list [-status <status>] [-app <app>] [-rev <rev>] [-proc <proc>] [-op <op>]",
+	Long: `
+Ticket-list returns the tickets matching the options given, ordered by id,
+and their status.
+
+Options:
+  -status  status, such as unclaimed or dead
+  -app     name of the application
+  -rev     name of the revision
+  -proc    name of the proctype
+  -op      operation, such as start or stop
+  `,
+}
+
+var ticketListStatus = cmdTicketList.Flag.String("status", "", "")
+var ticketListApp = cmdTicketList.Flag.String("app", "", "")
+var ticketListRev = cmdTicketList.Flag.String("rev", "", "")
+var ticketListProc = cmdTicketList.Flag.String("proc", "", "")
+var ticketListOp = cmdTicketList.Flag.String("op", "", "")
+
+func init() {
+	cmdTicketList.Run = runTicketList
+}
+
+func runTicketList(cmd *Command, args []string) {
+	s := cmdTicketList.Snapshot
+
+	if *ticketListOp != "" && visor.NewOperationType(*ticketListOp) == visor.OpInvalid {
+		fmt.Fprintf(os.Stderr, "Error invalid operation %s\n", *ticketListOp)
+		os.Exit(2)
+	}
+
+	filter := visor.TicketFilter{
+		App:      *ticketListApp,
+		Revision: *ticketListRev,
+		ProcType: visor.ProcessName(*ticketListProc),
+		Op:       *ticketListOp,
+		Status:   visor.TicketStatus(*ticketListStatus),
+	}
+
+	tickets, err := visor.Tickets(s, filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching tickets %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	for _, t := range tickets {
+		fmt.Fprintf(os.Stdout, "%s %s\n", t.Fields(), t.Status)
+	}
+}
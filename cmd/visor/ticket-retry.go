@@ -0,0 +1,56 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+	"strconv"
+)
+
+var cmdTicketRetry = &Command{
+	Name:      "ticket-retry",
+	Short:     "retry dead tickets",
+	UsageLine: "ticket-retry <id>...",
+	Long: `
+Ticket-retry takes dead tickets out of the dead-letter area and makes them
+claimable again, with a fresh set of attempts.
+  `,
+}
+
+func init() {
+	cmdTicketRetry.Run = runTicketRetry
+}
+
+func runTicketRetry(cmd *Command, args []string) {
+	if len(args) < 1 {
+		cmd.Flag.Usage()
+	}
+
+	s := cmdTicketRetry.Snapshot
+
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing ticket id %s\n", err.Error())
+			os.Exit(2)
+		}
+
+		t, err := visor.GetTicket(s, id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching ticket %s\n", err.Error())
+			os.Exit(2)
+		}
+
+		t, err = t.Retry()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error retrying ticket %s\n", err.Error())
+			os.Exit(2)
+		}
+		s = t.Snapshot
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+	"strconv"
+)
+
+var cmdTicketWait = &Command{
+	Name:      "ticket-wait",
+	Short:     "wait for tickets to finish",
+	UsageLine: "ticket-wait [-timeout <duration>] <id>...",
+	Long: `
+Ticket-wait waits until the tickets given are done, dead or cancelled, and
+prints their status. It exits with status 1 if any of them isn't done.
+
+Options:
+  -timeout  give up after the duration, 0 to wait forever (0)
+  `,
+}
+
+var ticketWaitTimeout = cmdTicketWait.Flag.Duration("timeout", 0, "")
+
+func init() {
+	cmdTicketWait.Run = runTicketWait
+}
+
+func runTicketWait(cmd *Command, args []string) {
+	if len(args) < 1 {
+		cmd.Flag.Usage()
+	}
+
+	s := cmdTicketWait.Snapshot
+	ctx := context.Background()
+
+	if *ticketWaitTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, *ticketWaitTimeout)
+		defer cancel()
+	}
+
+	failed := false
+
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing ticket id %s\n", err.Error())
+			os.Exit(2)
+		}
+
+		t, err := visor.GetTicket(s, id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching ticket %s\n", err.Error())
+			os.Exit(2)
+		}
+
+		status := t.Status
+		if !status.Final() {
+			status, _, err = visor.WaitTicketProcessedContext(ctx, s, id)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error waiting for ticket %d %s\n", id, err.Error())
+				os.Exit(2)
+			}
+		}
+		fmt.Fprintf(os.Stdout, "%d %s\n", id, status)
+
+		if status != visor.TicketStatusDone {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdTicketsDead = &Command{
+	Name:      "tickets-dead",
+	Short:     "list dead tickets",
+	UsageLine: "tickets-dead",
+	Long: `
+Tickets-dead lists the tickets which failed on all attempts, with the number
+of attempts and the reason the last one failed. They can be retried with
+ticket-retry.
+  `,
+}
+
+func init() {
+	cmdTicketsDead.Run = runTicketsDead
+}
+
+func runTicketsDead(cmd *Command, args []string) {
+	s := cmdTicketsDead.Snapshot
+
+	tickets, err := visor.DeadTickets(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error fetching dead tickets %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	for _, t := range tickets {
+		reason := ""
+		if a := t.LastAttempt(); a != nil {
+			reason = a.Reason
+		}
+		fmt.Fprintf(os.Stdout, "%s %d %s\n", t.Fields(), len(t.Attempts), reason)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+	"strings"
+	"time"
+)
+
+var cmdTicketsGc = &Command{
+	Name:      "tickets-gc",
+	Short:     "remove finished tickets",
+	UsageLine: "tickets-gc [-older-than <duration>] [-keep <count>] [-status <status>]",
+	Long: `
+Tickets-gc removes done, dead and cancelled tickets which finished longer
+ago than the duration given, or which aren't among the most recent ones
+kept. Unclaimed and claimed tickets are never removed. It prints the
+removed tickets.
+
+Options:
+  -older-than  remove tickets finished longer ago, 0 to disable (168h)
+  -keep        number of most recent tickets to keep, 0 to disable (0)
+  -status      comma separated statuses to remove (done,dead,cancelled)
+  `,
+}
+
+var gcOlderThan = cmdTicketsGc.Flag.Duration("older-than", 7*24*time.Hour, "")
+var gcKeep = cmdTicketsGc.Flag.Int("keep", 0, "")
+var gcStatus = cmdTicketsGc.Flag.String("status", "done,dead,cancelled", "")
+
+func init() {
+	cmdTicketsGc.Run = runTicketsGc
+}
+
+func runTicketsGc(cmd *Command, args []string) {
+	s := cmdTicketsGc.Snapshot
+	gc := visor.TicketGC{OlderThan: *gcOlderThan, Keep: *gcKeep}
+
+	for _, status := range strings.Split(*gcStatus, ",") {
+		gc.Status = append(gc.Status, visor.TicketStatus(status))
+	}
+
+	removed, err := visor.CollectTickets(s, gc)
+	for _, t := range removed {
+		fmt.Fprintf(os.Stdout, "%s %s\n", t.Fields(), t.Status)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing tickets %s\n", err.Error())
+		os.Exit(2)
+	}
+}
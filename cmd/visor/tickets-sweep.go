@@ -0,0 +1,41 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package main
+
+import (
+	"fmt"
+	"github.com/soundcloud/visor"
+	"os"
+)
+
+var cmdTicketsSweep = &Command{
+	Name:      "tickets-sweep",
+	Short:     "requeue expired and retried tickets",
+	UsageLine: "tickets-sweep",
+	Long: `
+Tickets-sweep unclaims claimed tickets whose lease expired, as well as failed
+tickets whose retry backoff passed, so they can be claimed again. It prints
+them with the number of times they were requeued. Claims without a lease are
+left alone.
+  `,
+}
+
+func init() {
+	cmdTicketsSweep.Run = runTicketsSweep
+}
+
+func runTicketsSweep(cmd *Command, args []string) {
+	s := cmdTicketsSweep.Snapshot
+
+	requeued, err := visor.SweepTickets(s)
+	for _, t := range requeued {
+		fmt.Fprintf(os.Stdout, "%s %d\n", t.Fields(), t.Requeues)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error sweeping tickets %s\n", err.Error())
+		os.Exit(2)
+	}
+}
@@ -6,37 +6,75 @@
 package visor
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"github.com/soundcloud/doozer"
+	"path"
 	"strings"
+	"sync"
+	"time"
 )
 
-// Conn is a wrapper around doozer.Conn,
+// Conn is a wrapper around a Backend,
 // providing some additional and sometimes
 // higher-level methods.
+//
+// When the connection to the coordinator is lost, Conn reconnects on its
+// own, see (*Conn).reconnect. Reads and waits are retried on the new
+// connection, writes fail as it's unknown if they were applied.
 type Conn struct {
 	Addr string
 	Root string
-	conn *doozer.Conn
+	conn Backend
+
+	// Reconnection settings, zero values select the defaults.
+	MaxReconnects int           // Attempts to reconnect before an operation fails
+	MinBackoff    time.Duration // Delay before the second attempt, doubled with every attempt
+	MaxBackoff    time.Duration // Maximum delay between attempts
+
+	dial      func() (Backend, error)
+	mu        sync.Mutex
+	gen       int
+	state     ConnState
+	redialing chan struct{}
+	hooks     []func(ConnState, error)
 }
 
-// Set calls (*doozer.Conn).Set with a prefixed path
+// Set calls (Backend).Set with a prefixed path
 func (c *Conn) Set(path string, rev int64, value []byte) (newrev int64, err error) {
 	path = c.prefixPath(path)
-	newrev, err = c.conn.Set(path, rev, value)
+	err = c.do(false, func(b Backend) (e error) {
+		newrev, e = b.Set(path, rev, value)
+		return
+	})
 	if err != nil {
-		if newrev == 0 { // err + newrev == 0: REV MISMATCH
-			_, newrev, _ = c.Stat(path)
+		if IsErrRevMismatch(err) {
+			c.do(true, func(b Backend) (e error) {
+				_, newrev, e = b.Stat(path, nil)
+				return
+			})
+
+			return newrev, &Error{
+				Err:     ErrRevMismatch,
+				Message: fmt.Sprintf("error setting file '%s' to '%s': file rev %d is newer than %d", path, string(value), newrev, rev),
+				Op:      "set",
+				Path:    path,
+				Rev:     rev,
+				FileRev: newrev,
+			}
 		}
-		err = errors.New(fmt.Sprintf("error setting file '%s' to '%s': %s", path, string(value), err.Error()))
+		err = opError("set", path, rev, err)
 	}
 	return
 }
 
-// Stat calls (*doozer.Conn).Stat with a prefixed path
+// Stat calls (Backend).Stat with a prefixed path
 func (c *Conn) Stat(path string) (len int, pathrev int64, err error) {
-	return c.conn.Stat(c.prefixPath(path), nil)
+	path = c.prefixPath(path)
+	err = c.do(true, func(b Backend) (e error) {
+		len, pathrev, e = b.Stat(path, nil)
+		return
+	})
+	return len, pathrev, opError("stat", path, 0, err)
 }
 
 // Exists returns true or false depending on if the path exists
@@ -46,9 +84,13 @@ func (c *Conn) Exists(path string) (exists bool, pathrev int64, err error) {
 
 // ExistsRev returns true or false depending on if the path exists
 func (c *Conn) ExistsRev(path string, rev *int64) (exists bool, pathrev int64, err error) {
-	_, pathrev, err = c.conn.Stat(c.prefixPath(path), rev)
-	if err != nil {
+	path = c.prefixPath(path)
+	err = c.do(true, func(b Backend) (e error) {
+		_, pathrev, e = b.Stat(path, rev)
 		return
+	})
+	if err != nil {
+		return false, pathrev, opError("stat", path, revOf(rev), err)
 	}
 
 	// directories have negative revisions and should also be found
@@ -66,19 +108,27 @@ func (c *Conn) Create(path string, value []byte) (newrev int64, err error) {
 		return
 	}
 	if exists {
-		return newrev, errors.New(fmt.Sprintf("path %s already exists", path))
+		return newrev, &Error{Err: ErrKeyConflict, Message: fmt.Sprintf("path %s already exists", path), Op: "create", Path: path}
 	}
 	return c.Set(path, newrev, value)
 }
 
-// Rev is a wrapper around (*doozer.Conn).Rev.
-func (c *Conn) Rev() (int64, error) {
-	return c.conn.Rev()
+// Rev is a wrapper around (Backend).Rev.
+func (c *Conn) Rev() (rev int64, err error) {
+	err = c.do(true, func(b Backend) (e error) {
+		rev, e = b.Rev()
+		return
+	})
+	return rev, opError("rev", "", 0, err)
 }
 
-// Get is a wrapper around (*doozer.Conn).Get with a prefixed path.
+// Get is a wrapper around (Backend).Get with a prefixed path.
 func (c *Conn) Get(path string, rev *int64) (value []byte, filerev int64, err error) {
-	value, filerev, err = c.conn.Get(c.prefixPath(path), rev)
+	p := c.prefixPath(path)
+	err = c.do(true, func(b Backend) (e error) {
+		value, filerev, e = b.Get(p, rev)
+		return
+	})
 
 	// If the file revision is 0 and there is no error, set the error appropriately.
 	// We don't want to overwrite the error in case it is network-related.
@@ -89,55 +139,250 @@ func (c *Conn) Get(path string, rev *int64) (value []byte, filerev int64, err er
 			err = NewError(ErrNoEnt, fmt.Sprintf("path \"%s\" not found at %d", path, *rev))
 		}
 	}
-	return
+	return value, filerev, opError("get", p, revOf(rev), err)
 }
 
-// Getdir is a wrapper around (*doozer.Conn).Getdir with a prefixed path.
+// Getdir is a wrapper around (Backend).Getdir with a prefixed path.
 func (c *Conn) Getdir(path string, rev int64) (keys []string, err error) {
+	p := c.prefixPath(path)
 	if rev < 0 {
-		return nil, fmt.Errorf("rev must be >= 0")
+		return nil, &Error{Err: ErrRange, Message: "rev must be >= 0", Op: "getdir", Path: p, Rev: rev}
 	}
-	keys, err = c.conn.Getdir(c.prefixPath(path), rev, 0, -1)
-	if err == doozer.ErrNoEnt || (err != nil && err.Error() == "NOENT") {
+	err = c.do(true, func(b Backend) (e error) {
+		keys, e = b.Getdir(p, rev, 0, -1)
+		return
+	})
+	if IsErrNoEnt(err) {
 		err = NewError(ErrNoEnt, fmt.Sprintf(`dir "%s" not found at %d`, path, rev))
 	}
-	return
+	return keys, opError("getdir", p, rev, err)
+}
+
+// Wait is a wrapper around (Backend).Wait
+func (c *Conn) Wait(path string, rev int64) (event Change, err error) {
+	return c.WaitContext(context.Background(), path, rev)
 }
 
-// Wait is a wrapper around (*doozer.Conn).Wait
-func (c *Conn) Wait(path string, rev int64) (event doozer.Event, err error) {
+// WaitContext is like Wait, but returns once ctx is done. Backends which
+// don't implement ContextBackend can't abort a pending wait, in which case
+// it's left running until the next matching change.
+//
+// If the connection is lost, the wait is resumed at rev once reconnected,
+// so no change is missed. It keeps reconnecting until ctx is done.
+func (c *Conn) WaitContext(ctx context.Context, path string, rev int64) (event Change, err error) {
+	ws := c.waitSession(ctx)
+	defer ws.Close()
+
+	return ws.Wait(path, rev)
+}
+
+// waitSession is a series of waits on a Conn, like WaitContext. The
+// Waiter of the backend is kept across the waits, so that watch loops
+// don't pay for setting it up, such as dialing a connection, on every
+// change. It's reopened once the connection is reestablished.
+type waitSession struct {
+	c   *Conn
+	ctx context.Context
+	w   Waiter
+	gen int // Generation of the backend w belongs to
+}
+
+func (c *Conn) waitSession(ctx context.Context) *waitSession {
+	return &waitSession{c: c, ctx: ctx}
+}
+
+// Wait is like (*Conn).WaitContext with the session's ctx.
+func (ws *waitSession) Wait(path string, rev int64) (event Change, err error) {
+	c := ws.c
 	path = c.prefixPath(path)
-	event, err = c.conn.Wait(path, rev)
+
+	for {
+		b, gen := c.backend()
+
+		event, err = ws.wait(b, gen, path, rev)
+		if !c.lost(err) {
+			break
+		}
+		if e := c.reconnect(ws.ctx, gen, err); e == ErrClosed || ws.ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		return Change{}, opError("wait", path, rev, err)
+	}
 	event.Path = strings.Replace(event.Path, c.Root, "", 1)
 	return
 }
 
-// Wait is a wrapper around (*doozer.Conn).Close
+func (ws *waitSession) wait(b Backend, gen int, path string, rev int64) (event Change, err error) {
+	cb, ok := b.(ContextBackend)
+	if !ok {
+		var e error
+		if err = withContext(ws.ctx, func() { event, e = b.Wait(path, rev) }); err != nil {
+			return Change{}, err
+		}
+		return event, e
+	}
+
+	if ws.w == nil || ws.gen != gen {
+		ws.Close()
+		if ws.w, err = cb.Waiter(ws.ctx); err != nil {
+			return
+		}
+		ws.gen = gen
+	}
+	// A waiter which failed is opened anew by the next wait.
+	if event, err = ws.w.Wait(path, rev); err != nil {
+		ws.Close()
+	}
+	return
+}
+
+// Close releases the Waiter of the session.
+func (ws *waitSession) Close() {
+	if ws.w != nil {
+		ws.w.Close()
+		ws.w = nil
+	}
+}
+
+// Close is a wrapper around (Backend).Close, the connection isn't
+// reestablished afterwards.
 func (c *Conn) Close() {
-	c.conn.Close()
+	b, _ := c.backend()
+	c.setState(ConnClosed, nil)
+	b.Close()
 }
 
-// Del is a wrapper around (*doozer.Conn).Del which also supports
+// Del is a wrapper around (Backend).Del which also supports
 // deleting directories.
 func (c *Conn) Del(path string, rev int64) (err error) {
 	path = c.prefixPath(path)
+	err = c.do(false, func(b Backend) error { return del(b, path, rev) })
+	return opError("del", path, rev, err)
+}
 
-	err = doozer.Walk(c.conn, rev, path, func(path string, f *doozer.FileInfo, e error) error {
-		if e != nil {
-			return e
-		}
+func del(b Backend, p string, rev int64) error {
+	_, filerev, err := b.Stat(p, &rev)
+	if err != nil {
+		return err
+	}
 
-		if !f.IsDir {
-			e = c.conn.Del(path, rev)
-			if e != nil {
-				return e
-			}
+	switch {
+	case filerev == 0:
+		return NewError(ErrNoEnt, fmt.Sprintf(`path "%s" not found at %d`, p, rev))
+	case filerev > 0:
+		return b.Del(p, rev)
+	}
+
+	names, err := b.Getdir(p, rev, 0, -1)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err = del(b, path.Join(p, name), rev)
+		if err != nil {
+			return err
 		}
+	}
+	return nil
+}
+
+// GetContext is like Get, but returns early with ctx.Err() once ctx is done.
+func (c *Conn) GetContext(ctx context.Context, path string, rev *int64) (value []byte, filerev int64, err error) {
+	var (
+		v []byte
+		r int64
+		e error
+	)
+	if err = withContext(ctx, func() { v, r, e = c.Get(path, rev) }); err != nil {
+		return nil, 0, opError("get", c.prefixPath(path), revOf(rev), err)
+	}
+	return v, r, e
+}
+
+// SetContext is like Set, but returns early with ctx.Err() once ctx is done.
+func (c *Conn) SetContext(ctx context.Context, path string, rev int64, value []byte) (newrev int64, err error) {
+	var (
+		r int64
+		e error
+	)
+	if err = withContext(ctx, func() { r, e = c.Set(path, rev, value) }); err != nil {
+		return 0, opError("set", c.prefixPath(path), rev, err)
+	}
+	return r, e
+}
+
+// DelContext is like Del, but returns early with ctx.Err() once ctx is done.
+func (c *Conn) DelContext(ctx context.Context, path string, rev int64) (err error) {
+	var e error
+	if err = withContext(ctx, func() { e = c.Del(path, rev) }); err != nil {
+		return opError("del", c.prefixPath(path), rev, err)
+	}
+	return e
+}
 
+// ExistsRevContext is like ExistsRev, but returns early with ctx.Err() once ctx is done.
+func (c *Conn) ExistsRevContext(ctx context.Context, path string, rev *int64) (exists bool, pathrev int64, err error) {
+	var (
+		x bool
+		r int64
+		e error
+	)
+	if err = withContext(ctx, func() { x, r, e = c.ExistsRev(path, rev) }); err != nil {
+		return false, 0, opError("stat", c.prefixPath(path), revOf(rev), err)
+	}
+	return x, r, e
+}
+
+// GetdirContext is like Getdir, but returns early with ctx.Err() once ctx is done.
+func (c *Conn) GetdirContext(ctx context.Context, path string, rev int64) (keys []string, err error) {
+	var (
+		k []string
+		e error
+	)
+	if err = withContext(ctx, func() { k, e = c.Getdir(path, rev) }); err != nil {
+		return nil, opError("getdir", c.prefixPath(path), rev, err)
+	}
+	return k, e
+}
+
+// RevContext is like Rev, but returns early with ctx.Err() once ctx is done.
+func (c *Conn) RevContext(ctx context.Context) (rev int64, err error) {
+	var (
+		r int64
+		e error
+	)
+	if err = withContext(ctx, func() { r, e = c.Rev() }); err != nil {
+		return 0, opError("rev", "", 0, err)
+	}
+	return r, e
+}
+
+// withContext runs op and waits for it to finish, unless ctx is done first,
+// in which case ctx.Err() is returned. As backends can't abort operations in
+// flight, op then finishes in the background and its results are discarded.
+func withContext(ctx context.Context, op func()) error {
+	if ctx.Done() == nil {
+		op()
 		return nil
-	})
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	return
+	done := make(chan struct{})
+	go func() {
+		op()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // GetMulti returns multiple key/value pairs organized in a map.
@@ -171,6 +416,92 @@ func (c *Conn) SetMulti(path string, kvs map[string][]byte, rev int64) (newrev i
 	return
 }
 
+// Batch applies the mutations with prefixed paths all-or-nothing. If the
+// backend doesn't support batches, the mutations are applied one by one
+// and the ones already applied are rolled back if one of them fails.
+func (c *Conn) Batch(muts []Mutation) (newrev int64, err error) {
+	prefixed := make([]Mutation, len(muts))
+	for i, m := range muts {
+		m.Path = c.prefixPath(m.Path)
+		prefixed[i] = m
+	}
+
+	err = c.do(false, func(b Backend) (e error) {
+		if bb, ok := b.(BatchBackend); ok {
+			newrev, e = bb.Batch(prefixed)
+			return opError("batch", "", 0, e)
+		}
+		newrev, e = batch(b, prefixed)
+		return
+	})
+	return
+}
+
+// batchUndo holds what is needed to revert a single applied mutation.
+type batchUndo struct {
+	path    string
+	rev     int64
+	value   []byte
+	existed bool
+}
+
+func batch(b Backend, muts []Mutation) (newrev int64, err error) {
+	undos := []batchUndo{}
+
+	for _, m := range muts {
+		var (
+			value   []byte
+			filerev int64
+		)
+
+		value, filerev, err = b.Get(m.Path, nil)
+		if err == nil {
+			if m.Del {
+				err = b.Del(m.Path, m.Rev)
+				if err == nil {
+					newrev, err = b.Rev()
+				}
+			} else {
+				newrev, err = b.Set(m.Path, m.Rev, m.Value)
+			}
+		}
+		if err != nil {
+			err = opError("batch", m.Path, m.Rev, err)
+			if e := rollback(b, undos); e != nil {
+				err = fmt.Errorf("%w (rollback failed: %s)", err, e.Error())
+			}
+			return 0, err
+		}
+		undos = append(undos, batchUndo{m.Path, newrev, value, filerev > 0})
+	}
+	return
+}
+
+// rollback reverts applied mutations in reverse order, it fails if
+// any of the files was changed since the mutation was applied.
+func rollback(b Backend, undos []batchUndo) (err error) {
+	for i := len(undos) - 1; i >= 0; i-- {
+		u := undos[i]
+
+		if u.existed {
+			_, err = b.Set(u.path, u.rev, u.value)
+		} else {
+			err = b.Del(u.path, u.rev)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func revOf(rev *int64) int64 {
+	if rev == nil {
+		return 0
+	}
+	return *rev
+}
+
 func (c *Conn) prefixPath(p string) (path string) {
 	prefix := c.Root
 	path = p
@@ -5,10 +5,16 @@
 
 package visor
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
 
 func connSetup() (*Conn, int64) {
-	s, err := Dial(DEFAULT_ADDR, "/conn-test")
+	s, err := testDial("/conn-test")
 	if err != nil {
 		panic(err)
 	}
@@ -25,7 +31,7 @@ func connSetup() (*Conn, int64) {
 func TestConnDifferentRoot(t *testing.T) {
 	body := "test"
 
-	s, _ := Dial(DEFAULT_ADDR, "/not-conn-test")
+	s, _ := testDial("/not-conn-test")
 
 	_, err := s.conn.Set("root", s.Rev, []byte(body))
 	if err != nil {
@@ -74,3 +80,207 @@ func TestConnExists(t *testing.T) {
 		t.Errorf("rev for %s should = 0", k)
 	}
 }
+
+func testConnWaitContext(c *Conn, rev int64, t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		_, err := c.WaitContext(ctx, "wait-key", rev+1)
+		done <- err
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("wait didn't return after cancel")
+	}
+}
+
+func TestConnWaitContext(t *testing.T) {
+	c, rev := connSetup()
+	n := runtime.NumGoroutine()
+
+	testConnWaitContext(c, rev, t)
+
+	expectGoroutines(n, t)
+}
+
+func TestConnWaitContextFallback(t *testing.T) {
+	c, rev := connSetup()
+	c = &Conn{Addr: c.Addr, Root: c.Root, conn: plainBackend{c.conn}}
+	n := runtime.NumGoroutine()
+
+	testConnWaitContext(c, rev, t)
+
+	// The abandoned wait returns with the next matching change.
+	if _, err := c.Set("wait-key", -1, []byte{}); err != nil {
+		t.Fatal(err)
+	}
+	expectGoroutines(n, t)
+}
+
+func TestConnContextDeadline(t *testing.T) {
+	c, rev := connSetup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := c.WaitContext(ctx, "wait-key", rev+1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	_, _, err = c.GetContext(ctx, "key", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	_, err = c.SetContext(context.Background(), "key", rev, []byte("value"))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// dropConn closes the backend of c behind its back,
+// as if the connection to the coordinator was lost.
+func dropConn(c *Conn) {
+	b, _ := c.backend()
+	b.Close()
+}
+
+func TestConnReconnect(t *testing.T) {
+	c, rev := connSetup()
+	states := make(chan ConnState, 10)
+	c.OnStateChange(func(state ConnState, err error) { states <- state })
+
+	rev, err := c.Set("key", rev, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dropConn(c)
+
+	val, _, err := c.Get("key", &rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "value" {
+		t.Errorf("expected 'value', got '%s'", val)
+	}
+
+	for _, expected := range []ConnState{ConnDisconnected, ConnConnected} {
+		if state := <-states; state != expected {
+			t.Errorf("expected state %s, got %s", expected, state)
+		}
+	}
+	if c.State() != ConnConnected {
+		t.Errorf("expected state %s, got %s", ConnConnected, c.State())
+	}
+}
+
+func TestConnReconnectWrite(t *testing.T) {
+	c, rev := connSetup()
+
+	dropConn(c)
+
+	// Writes aren't retried, but the connection is reestablished.
+	_, err := c.Set("key", rev, []byte("value"))
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if _, err = c.Set("key", rev, []byte("value")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnReconnectWait(t *testing.T) {
+	c, rev := connSetup()
+
+	s, err := testDial(c.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan Change, 1)
+
+	go func() {
+		ev, err := c.Wait("wait-key", rev+1)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- ev
+	}()
+
+	dropConn(c)
+
+	// Written while the connection is down, the change must not be missed.
+	if _, err = s.Set("wait-key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-done:
+		if ev.Path != "/wait-key" || string(ev.Body) != "value" {
+			t.Errorf("unexpected change %#v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Error("wait didn't resume after reconnect")
+	}
+}
+
+func TestConnReconnectBackoff(t *testing.T) {
+	c, _ := connSetup()
+	c.MinBackoff = time.Millisecond
+	c.MaxReconnects = 3
+
+	attempts, dial := 0, c.dial
+	c.dial = func() (Backend, error) {
+		if attempts++; attempts < 3 {
+			return nil, ErrClosed
+		}
+		return dial()
+	}
+
+	dropConn(c)
+
+	if _, err := c.Rev(); err != nil {
+		t.Error(err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+
+	// Without a reachable coordinator, reads fail once all attempts are used up.
+	attempts = 0
+	c.dial = func() (Backend, error) {
+		attempts++
+		return nil, ErrClosed
+	}
+
+	dropConn(c)
+
+	if _, err := c.Rev(); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if c.State() != ConnDisconnected {
+		t.Errorf("expected state %s, got %s", ConnDisconnected, c.State())
+	}
+}
+
+func TestConnCloseNoReconnect(t *testing.T) {
+	c, _ := connSetup()
+
+	c.Close()
+
+	if _, err := c.Rev(); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if c.State() != ConnClosed {
+		t.Errorf("expected state %s, got %s", ConnClosed, c.State())
+	}
+}
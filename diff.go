@@ -0,0 +1,150 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// DiffOp tells how a file differs between two snapshots.
+type DiffOp string
+
+const (
+	DiffAdded   DiffOp = "added"
+	DiffRemoved DiffOp = "removed"
+	DiffChanged DiffOp = "changed"
+)
+
+// Kinds of domain objects reported by Diff, in the order they are reported.
+const (
+	DiffApp      = "app"
+	DiffEnv      = "env"
+	DiffRevision = "revision"
+	DiffScale    = "scale"
+	DiffProcType = "proctype"
+	DiffInstance = "instance"
+	DiffService  = "service"
+	DiffEndpoint = "endpoint"
+	DiffTicket   = "ticket"
+	DiffHost     = "host"
+	DiffOther    = "other"
+)
+
+var diffKinds = []string{
+	DiffApp, DiffEnv, DiffRevision, DiffScale, DiffProcType,
+	DiffInstance, DiffService, DiffEndpoint, DiffTicket, DiffHost, DiffOther,
+}
+
+// DiffEntry is a file which differs between two snapshots, described
+// by the domain object it belongs to. For example, the environment
+// variable FOO of app "cat" is reported with Kind DiffEnv, Object "cat"
+// and Key "FOO".
+type DiffEntry struct {
+	Op     DiffOp
+	Kind   string
+	Object string
+	Key    string
+	Path   string
+	Old    string
+	New    string
+}
+
+// Diff returns the files which were added, removed or changed between
+// s1 and s2. Entries are grouped by kind and object.
+func Diff(s1, s2 Snapshot) (entries []DiffEntry, err error) {
+	d1, err := DumpSnapshot(s1)
+	if err != nil {
+		return
+	}
+	d2, err := DumpSnapshot(s2)
+	if err != nil {
+		return
+	}
+
+	entries = []DiffEntry{}
+
+	for p, old := range d1.Files {
+		if value, ok := d2.Files[p]; !ok {
+			entries = append(entries, newDiffEntry(DiffRemoved, p, old, ""))
+		} else if value != old {
+			entries = append(entries, newDiffEntry(DiffChanged, p, old, value))
+		}
+	}
+	for p, value := range d2.Files {
+		if _, ok := d1.Files[p]; !ok {
+			entries = append(entries, newDiffEntry(DiffAdded, p, "", value))
+		}
+	}
+
+	sort.Sort(diffEntries(entries))
+	return
+}
+
+func newDiffEntry(op DiffOp, p string, old string, value string) DiffEntry {
+	kind, object, key := diffObject(p)
+	return DiffEntry{Op: op, Kind: kind, Object: object, Key: key, Path: p, Old: old, New: value}
+}
+
+// diffObject maps a path to the domain object it belongs to.
+func diffObject(p string) (kind string, object string, key string) {
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	n := len(parts)
+
+	switch {
+	case parts[0] == APPS_PATH && n == 3:
+		return DiffApp, parts[1], parts[2]
+	case parts[0] == APPS_PATH && n == 4 && parts[2] == "env":
+		return DiffEnv, parts[1], strings.Replace(parts[3], "-", "_", -1)
+	case parts[0] == APPS_PATH && n == 6 && parts[2] == REVS_PATH && parts[4] == SCALE_PATH:
+		return DiffScale, parts[1] + ":" + parts[3], parts[5]
+	case parts[0] == APPS_PATH && n > 4 && parts[2] == REVS_PATH:
+		return DiffRevision, parts[1] + ":" + parts[3], path.Join(parts[4:]...)
+	case parts[0] == APPS_PATH && n == 6 && parts[2] == PROCS_PATH && parts[4] == INSTANCES_PATH:
+		return DiffInstance, parts[5], parts[1] + ":" + parts[3]
+	case parts[0] == APPS_PATH && n > 4 && parts[2] == PROCS_PATH:
+		return DiffProcType, parts[1] + ":" + parts[3], path.Join(parts[4:]...)
+	case parts[0] == INSTANCES_PATH && n > 2:
+		return DiffInstance, parts[1], path.Join(parts[2:]...)
+	case parts[0] == SERVICES_PATH && n == 4 && parts[2] == ENDPOINTS_PATH:
+		return DiffEndpoint, parts[1], parts[3]
+	case parts[0] == SERVICES_PATH && n > 2:
+		return DiffService, parts[1], path.Join(parts[2:]...)
+	case parts[0] == TICKETS_PATH && n > 2:
+		return DiffTicket, parts[1], path.Join(parts[2:]...)
+	case parts[0] == DEAD_TICKETS_PATH && n == 2:
+		return DiffTicket, parts[1], DEAD_TICKETS_PATH
+	case parts[0] == HOSTS_PATH && n > 2:
+		return DiffHost, parts[1], path.Join(parts[2:]...)
+	}
+	return DiffOther, "", p
+}
+
+type diffEntries []DiffEntry
+
+func (e diffEntries) Len() int      { return len(e) }
+func (e diffEntries) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e diffEntries) Less(i, j int) bool {
+	a, b := e[i], e[j]
+
+	if a.Kind != b.Kind {
+		return diffKindIndex(a.Kind) < diffKindIndex(b.Kind)
+	}
+	if a.Object != b.Object {
+		return a.Object < b.Object
+	}
+	return a.Key < b.Key
+}
+
+func diffKindIndex(kind string) int {
+	for i, k := range diffKinds {
+		if k == kind {
+			return i
+		}
+	}
+	return len(diffKinds)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"errors"
+	"testing"
+)
+
+func diffSetup() (s Snapshot, app *App) {
+	s, err := testDial("/diff-test")
+	if err != nil {
+		panic(err)
+	}
+	s.Del("/")
+	s = s.FastForward(-1)
+
+	app, err = NewApp("diff-app", "git://diff.git", "stack", s).Register()
+	if err != nil {
+		panic(err)
+	}
+	app, err = app.SetEnvironmentVar("OLD_VAR", "old")
+	if err != nil {
+		panic(err)
+	}
+	return app.Snapshot, app
+}
+
+func TestDiff(t *testing.T) {
+	s, app := diffSetup()
+
+	app, err := app.SetEnvironmentVar("NEW_VAR", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err = app.DelEnvironmentVar("OLD_VAR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, err := app.Snapshot.SetScale("diff-app", "abc123", "web", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Diff(s, s1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []DiffEntry{
+		{Op: DiffAdded, Kind: DiffEnv, Object: "diff-app", Key: "NEW_VAR", New: "new"},
+		{Op: DiffRemoved, Kind: DiffEnv, Object: "diff-app", Key: "OLD_VAR", Old: "old"},
+		{Op: DiffAdded, Kind: DiffScale, Object: "diff-app:abc123", Key: "web", New: "2"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %#v", len(expected), entries)
+	}
+	for i, e := range expected {
+		e.Path = entries[i].Path
+		if entries[i] != e {
+			t.Errorf("expected %#v, got %#v", e, entries[i])
+		}
+	}
+}
+
+func TestDiffAt(t *testing.T) {
+	s, app := diffSetup()
+
+	app, err := app.SetEnvironmentVar("NEW_VAR", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1 := app.Snapshot
+	if _, err = app.SetEnvironmentVar("LATER_VAR", "later"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Older revisions are reached from a snapshot at the latest one.
+	latest := s.FastForward(-1)
+
+	old, err := latest.At(s.Rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := latest.At(s1.Rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Rev != s.Rev || cur.Rev != s1.Rev {
+		t.Fatalf("expected snapshots at %d and %d, got %d and %d", s.Rev, s1.Rev, old.Rev, cur.Rev)
+	}
+
+	entries, err := Diff(old, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Op != DiffAdded || entries[0].Key != "NEW_VAR" {
+		t.Errorf("expected NEW_VAR to be added, got %#v", entries)
+	}
+
+	if _, err = latest.At(latest.Rev + 1); !errors.Is(err, ErrRange) {
+		t.Errorf("expected ErrRange for a future revision, got %v", err)
+	}
+	if _, err = latest.At(0); !errors.Is(err, ErrRange) {
+		t.Errorf("expected ErrRange for revision 0, got %v", err)
+	}
+}
+
+func TestDiffChanged(t *testing.T) {
+	s, app := diffSetup()
+
+	app, err := app.SetEnvironmentVar("OLD_VAR", "changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Diff(s, app.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %#v", entries)
+	}
+	if e := entries[0]; e.Op != DiffChanged || e.Old != "old" || e.New != "changed" || e.Path != "/apps/diff-app/env/OLD-VAR" {
+		t.Errorf("unexpected entry %#v", e)
+	}
+
+	if entries, _ = Diff(s, s); len(entries) != 0 {
+		t.Errorf("expected no entries, got %#v", entries)
+	}
+}
+
+func TestDiffObject(t *testing.T) {
+	paths := map[string][3]string{
+		"/apps/cat/attrs":                         {DiffApp, "cat", "attrs"},
+		"/apps/cat/revs/abc/archive-url":          {DiffRevision, "cat:abc", "archive-url"},
+		"/apps/cat/procs/web/port":                {DiffProcType, "cat:web", "port"},
+		"/apps/cat/procs/web/instances/1-2-3-4-5": {DiffInstance, "1-2-3-4-5", "cat:web"},
+		"/instances/1-2-3-4-5/state":              {DiffInstance, "1-2-3-4-5", "state"},
+		"/services/db/endpoints/10.0.0.1":         {DiffEndpoint, "db", "10.0.0.1"},
+		"/services/db/registered":                 {DiffService, "db", "registered"},
+		"/tickets/42/status":                      {DiffTicket, "42", "status"},
+		"/dead-tickets/42":                        {DiffTicket, "42", "dead-tickets"},
+		"/hosts/box-1.example.com/attrs":          {DiffHost, "box-1.example.com", "attrs"},
+		"/next-port":                              {DiffOther, "", "/next-port"},
+	}
+
+	for p, expected := range paths {
+		kind, object, key := diffObject(p)
+		if [3]string{kind, object, key} != expected {
+			t.Errorf("expected %s to map to %v, got %v", p, expected, [3]string{kind, object, key})
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"context"
+	"fmt"
+	"github.com/soundcloud/doozer"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// doozerConn is the part of *doozer.Conn used by doozerBackend.
+type doozerConn interface {
+	Get(path string, rev *int64) ([]byte, int64, error)
+	Set(path string, rev int64, value []byte) (int64, error)
+	Del(path string, rev int64) error
+	Stat(path string, rev *int64) (int, int64, error)
+	Getdir(path string, rev int64, offset, limit int) ([]string, error)
+	Wait(glob string, rev int64) (doozer.Event, error)
+	Rev() (int64, error)
+	Close()
+}
+
+// doozerBackend implements Backend on top of a doozerd cluster.
+type doozerBackend struct {
+	conn doozerConn
+	dial func() (doozerConn, error) // Dials the member conn is connected to
+}
+
+func newDoozerBackend(conn *doozer.Conn, dial func() (*doozer.Conn, error)) *doozerBackend {
+	return &doozerBackend{
+		conn: conn,
+		dial: func() (doozerConn, error) {
+			c, err := dial()
+			if err != nil {
+				return nil, err
+			}
+			return c, nil
+		},
+	}
+}
+
+func init() {
+	RegisterBackend("doozer", dialDoozerUri)
+}
+
+func dialDoozer(addr string) (Backend, error) {
+	dial := func() (*doozer.Conn, error) { return doozer.Dial(addr) }
+
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	return newDoozerBackend(conn, dial), nil
+}
+
+// doozerMember is advanced with every dial, so that reconnects
+// start with the next member of the cluster.
+var doozerMember uint32
+
+// dialDoozerUri dials the cluster members listed in uri in turn,
+// starting with a different one each time.
+func dialDoozerUri(uri string) (b Backend, err error) {
+	uris := doozerMemberUris(uri)
+	start := int(atomic.AddUint32(&doozerMember, 1) - 1)
+
+	for i := range uris {
+		member := uris[(start+i)%len(uris)]
+		dial := func() (*doozer.Conn, error) { return doozer.DialUri(member, "") }
+
+		conn, e := dial()
+		if e == nil {
+			return newDoozerBackend(conn, dial), nil
+		}
+		err = e
+	}
+	return
+}
+
+// doozerMemberUris splits a uri listing several cluster members,
+// like "doozer:?ca=a:8046&ca=b:8046", into one uri per member.
+func doozerMemberUris(uri string) []string {
+	i := strings.Index(uri, "?")
+	if i < 0 {
+		return []string{uri}
+	}
+	params, err := url.ParseQuery(uri[i+1:])
+	if err != nil || len(params["ca"]) < 2 {
+		return []string{uri}
+	}
+
+	uris := []string{}
+	for _, addr := range params["ca"] {
+		p := url.Values{}
+		for k, v := range params {
+			p[k] = v
+		}
+		p["ca"] = []string{addr}
+		uris = append(uris, uri[:i+1]+p.Encode())
+	}
+	return uris
+}
+
+func (b *doozerBackend) Get(path string, rev *int64) ([]byte, int64, error) {
+	value, filerev, err := b.conn.Get(path, rev)
+	return value, filerev, doozerError(err, path)
+}
+
+func (b *doozerBackend) Set(path string, rev int64, value []byte) (int64, error) {
+	newrev, err := b.conn.Set(path, rev, value)
+	return newrev, doozerError(err, path)
+}
+
+func (b *doozerBackend) Del(path string, rev int64) error {
+	return doozerError(b.conn.Del(path, rev), path)
+}
+
+func (b *doozerBackend) Stat(path string, rev *int64) (int, int64, error) {
+	len, filerev, err := b.conn.Stat(path, rev)
+	return len, filerev, doozerError(err, path)
+}
+
+func (b *doozerBackend) Getdir(path string, rev int64, offset, limit int) ([]string, error) {
+	names, err := b.conn.Getdir(path, rev, offset, limit)
+	return names, doozerError(err, path)
+}
+
+func (b *doozerBackend) Wait(glob string, rev int64) (Change, error) {
+	ev, err := b.conn.Wait(glob, rev)
+	if err != nil {
+		return Change{}, doozerError(err, glob)
+	}
+	return Change{Rev: ev.Rev, Path: ev.Path, Body: ev.Body, Flag: ev.Flag}, nil
+}
+
+func (b *doozerBackend) WaitContext(ctx context.Context, glob string, rev int64) (Change, error) {
+	w, err := b.Waiter(ctx)
+	if err != nil {
+		return Change{}, err
+	}
+	defer w.Close()
+
+	return w.Wait(glob, rev)
+}
+
+// doozerWaiter waits on a connection of its own, which is closed once
+// ctx is done. Closing it aborts the pending wait, which can't be done
+// on the shared connection without failing all other requests on it.
+// Without a ctx which can be done, the shared connection is used.
+type doozerWaiter struct {
+	ctx  context.Context
+	conn doozerConn
+	done chan struct{}
+	once sync.Once
+}
+
+func (b *doozerBackend) Waiter(ctx context.Context) (Waiter, error) {
+	if ctx.Done() == nil {
+		return &doozerWaiter{ctx: ctx, conn: b.conn}, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn, err := b.dial()
+	if err != nil {
+		return nil, doozerError(err, "")
+	}
+	w := &doozerWaiter{ctx: ctx, conn: conn, done: make(chan struct{})}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.done:
+		}
+		conn.Close()
+	}()
+	return w, nil
+}
+
+func (w *doozerWaiter) Wait(glob string, rev int64) (Change, error) {
+	ev, err := w.conn.Wait(glob, rev)
+	if err != nil && w.ctx.Err() != nil {
+		return Change{}, w.ctx.Err()
+	}
+	if err != nil {
+		return Change{}, doozerError(err, glob)
+	}
+	return Change{Rev: ev.Rev, Path: ev.Path, Body: ev.Body, Flag: ev.Flag}, nil
+}
+
+// Close closes the connection of the waiter, if it has its own.
+func (w *doozerWaiter) Close() {
+	if w.done != nil {
+		w.once.Do(func() { close(w.done) })
+	}
+}
+
+func (b *doozerBackend) Rev() (int64, error) {
+	rev, err := b.conn.Rev()
+	return rev, doozerError(err, "")
+}
+
+func (b *doozerBackend) Close() {
+	b.conn.Close()
+}
+
+// doozerErrors maps doozer error codes to the errors of this package.
+var doozerErrors = map[string]error{
+	"OTHER":        ErrOther,
+	"TAG_IN_USE":   ErrTagInUse,
+	"UNKNOWN_VERB": ErrUnknownVerb,
+	"READONLY":     ErrReadonly,
+	"TOO_LATE":     ErrTooLate,
+	"REV_MISMATCH": ErrRevMismatch,
+	"BAD_PATH":     ErrBadPath,
+	"MISSING_ARG":  ErrMissingArg,
+	"RANGE":        ErrRange,
+	"NOTDIR":       ErrNotDir,
+	"ISDIR":        ErrIsDir,
+	"NOENT":        ErrNoEnt,
+}
+
+// doozerError translates errors returned by doozer into errors
+// understood by the rest of the package.
+func doozerError(err error, path string) error {
+	if err == nil {
+		return nil
+	}
+	if err == doozer.ErrClosed {
+		return &Error{Err: ErrClosed, Path: path}
+	}
+	// The connection broke, (*Conn) reconnects on ErrClosed.
+	if _, ok := err.(net.Error); ok || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &Error{Err: ErrClosed, Message: fmt.Sprintf("%s: %s", ErrClosed, err), Path: path}
+	}
+
+	code, detail := err, ""
+	if e, ok := err.(*doozer.Error); ok {
+		code, detail = e.Err, e.Detail
+	}
+	if sentinel, ok := doozerErrors[code.Error()]; ok {
+		e := &Error{Err: sentinel, Path: path}
+		if detail != "" {
+			e.Message = fmt.Sprintf("%s: %s (%s)", path, sentinel.Error(), detail)
+		}
+		return e
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"context"
+	"errors"
+	"github.com/soundcloud/doozer"
+	"io"
+	"net/url"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDoozerMemberUris(t *testing.T) {
+	uris := doozerMemberUris("doozer:?ca=10.0.0.1:8046&ca=10.0.0.2:8046&sk=secret")
+	if len(uris) != 2 {
+		t.Fatalf("expected 2 uris, got %v", uris)
+	}
+
+	for i, addr := range []string{"10.0.0.1:8046", "10.0.0.2:8046"} {
+		params, err := url.ParseQuery(uris[i][len("doozer:?"):])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ca := params["ca"]; len(ca) != 1 || ca[0] != addr {
+			t.Errorf("expected ca=%s, got %v", addr, ca)
+		}
+		if params.Get("sk") != "secret" {
+			t.Errorf("expected secret to be kept in %s", uris[i])
+		}
+	}
+
+	single := "doozer:?ca=10.0.0.1:8046"
+	if uris = doozerMemberUris(single); len(uris) != 1 || uris[0] != single {
+		t.Errorf("expected %s to be left as is, got %v", single, uris)
+	}
+}
+
+func TestDoozerConnErrors(t *testing.T) {
+	for _, err := range []error{io.EOF, io.ErrUnexpectedEOF} {
+		if e := doozerError(err, "/path"); !errors.Is(e, ErrClosed) {
+			t.Errorf("expected %s to map to ErrClosed, got %v", err, e)
+		}
+	}
+}
+
+// blockingDoozerConn is a doozerConn whose Wait blocks until an event is
+// sent or the connection is closed, like a doozer connection.
+type blockingDoozerConn struct {
+	doozerConn
+	events chan doozer.Event
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newBlockingDoozerConn() *blockingDoozerConn {
+	return &blockingDoozerConn{events: make(chan doozer.Event), closed: make(chan struct{})}
+}
+
+func (c *blockingDoozerConn) Wait(glob string, rev int64) (doozer.Event, error) {
+	select {
+	case ev := <-c.events:
+		return ev, nil
+	case <-c.closed:
+		return doozer.Event{}, doozer.ErrClosed
+	}
+}
+
+func (c *blockingDoozerConn) Close() {
+	c.once.Do(func() { close(c.closed) })
+}
+
+func blockingDoozerBackend() (b *doozerBackend, dialed chan *blockingDoozerConn) {
+	dialed = make(chan *blockingDoozerConn, 10)
+	b = &doozerBackend{
+		conn: newBlockingDoozerConn(),
+		dial: func() (doozerConn, error) {
+			c := newBlockingDoozerConn()
+			dialed <- c
+			return c, nil
+		},
+	}
+	return
+}
+
+func TestDoozerWaitContextCancel(t *testing.T) {
+	n := runtime.NumGoroutine()
+	b, dialed := blockingDoozerBackend()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := b.WaitContext(ctx, "/foo", 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	select {
+	case <-(<-dialed).closed:
+	default:
+		t.Error("expected the wait connection to be closed")
+	}
+	expectGoroutines(n, t)
+}
+
+func TestDoozerWaitContextEvent(t *testing.T) {
+	n := runtime.NumGoroutine()
+	b, dialed := blockingDoozerBackend()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		(<-dialed).events <- doozer.Event{Rev: 2, Path: "/foo", Body: []byte("bar"), Flag: 4}
+	}()
+
+	ev, err := b.WaitContext(ctx, "/foo", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Rev != 2 || ev.Path != "/foo" || string(ev.Body) != "bar" || !ev.IsSet() {
+		t.Errorf("unexpected event %#v", ev)
+	}
+	expectGoroutines(n, t)
+}
+
+func TestDoozerWatchReusesWaitConn(t *testing.T) {
+	n := runtime.NumGoroutine()
+	b, dialed := blockingDoozerBackend()
+	s := Snapshot{1, &Conn{Root: "/", conn: b}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := make(chan *Event)
+	done := make(chan error)
+
+	go func() {
+		done <- WatchEventRawContext(ctx, s, l)
+	}()
+
+	conn := <-dialed
+	for rev := int64(2); rev < 5; rev++ {
+		conn.events <- doozer.Event{Rev: rev, Path: "/foo", Body: []byte("bar"), Flag: 4}
+		if ev := <-l; ev.Rev != rev {
+			t.Errorf("expected event at %d, got %d", rev, ev.Rev)
+		}
+	}
+	if len(dialed) != 0 {
+		t.Errorf("expected one wait connection, got %d more", len(dialed))
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	select {
+	case <-conn.closed:
+	default:
+		t.Error("expected the wait connection to be closed")
+	}
+	expectGoroutines(n, t)
+}
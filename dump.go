@@ -0,0 +1,173 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// DUMP_VERSION is the version of the dump format written by DumpSnapshot.
+const DUMP_VERSION = 1
+
+// Dump is a copy of the whole coordinator tree under the root,
+// taken at a single revision.
+type Dump struct {
+	Version int               `json:"version"`
+	Rev     int64             `json:"rev"`
+	Root    string            `json:"root"`
+	Files   map[string]string `json:"files"` // File values by path, relative to the root
+}
+
+// DumpFilter selects the files of a dump by their path.
+type DumpFilter func(path string) bool
+
+// AppsOnly selects apps with their revisions, proctypes and environment,
+// but without instances.
+func AppsOnly(p string) bool {
+	return dumpPathIn(p, APPS_PATH) && !isInstancePath(p)
+}
+
+// ExcludeTickets selects everything but tickets, including
+// the dead-letter area.
+func ExcludeTickets(p string) bool {
+	return !dumpPathIn(p, TICKETS_PATH) && !dumpPathIn(p, DEAD_TICKETS_PATH)
+}
+
+// ExcludeInstances selects everything but instances, including
+// the instances registered with proctypes.
+func ExcludeInstances(p string) bool {
+	return !isInstancePath(p)
+}
+
+func dumpPathIn(p string, dir string) bool {
+	return strings.SplitN(strings.TrimPrefix(p, "/"), "/", 2)[0] == strings.TrimPrefix(dir, "/")
+}
+
+// isInstancePath reports whether p is below /instances
+// or /apps/<app>/procs/<proctype>/instances.
+func isInstancePath(p string) bool {
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+
+	switch {
+	case parts[0] == INSTANCES_PATH:
+		return true
+	case parts[0] == APPS_PATH && len(parts) > 4:
+		return parts[2] == PROCS_PATH && parts[4] == INSTANCES_PATH
+	}
+	return false
+}
+
+// DumpSnapshot returns a dump of all files under the root at the
+// snapshot's revision. Only files selected by all filters are included.
+func DumpSnapshot(s Snapshot, filters ...DumpFilter) (d *Dump, err error) {
+	d = &Dump{Version: DUMP_VERSION, Rev: s.Rev, Root: s.conn.Root, Files: map[string]string{}}
+
+	err = dumpDir(s, "/", func(p string, value []byte) {
+		if selected(p, filters) {
+			d.Files[p] = string(value)
+		}
+	})
+	if IsErrNoEnt(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func dumpDir(s Snapshot, dir string, fn func(p string, value []byte)) error {
+	names, err := s.conn.Getdir(dir, s.Rev)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		p := path.Join(dir, name)
+
+		_, filerev, err := s.conn.ExistsRev(p, &s.Rev)
+		if err != nil {
+			return err
+		}
+		if filerev < 0 {
+			if err = dumpDir(s, p, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, _, err := s.conn.Get(p, &s.Rev)
+		if err != nil {
+			return err
+		}
+		fn(p, value)
+	}
+	return nil
+}
+
+func selected(p string, filters []DumpFilter) bool {
+	for _, f := range filters {
+		if !f(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Load restores the files of a dump selected by all filters into the
+// root, which must be empty. The files are written all-or-nothing.
+// Unique IDs, such as ticket IDs, are revisions of the coordinator,
+// so restoring into a coordinator at a lower revision than the dump's
+// can cause IDs to be issued twice.
+func Load(s Snapshot, d *Dump, filters ...DumpFilter) (s1 Snapshot, err error) {
+	if d.Version > DUMP_VERSION {
+		return s, NewError(ErrInvalidState, fmt.Sprintf("dump version %d is newer than supported version %d", d.Version, DUMP_VERSION))
+	}
+
+	s = s.FastForward(-1)
+
+	names, err := s.conn.Getdir("/", s.Rev)
+	if err != nil && !IsErrNoEnt(err) {
+		return s, err
+	}
+	if len(names) > 0 {
+		return s, &Error{Err: ErrKeyConflict, Message: fmt.Sprintf("root %s is not empty", s.conn.Root), Op: "load", Path: s.conn.Root}
+	}
+
+	txn := s.Txn()
+	for p, value := range d.Files {
+		if selected(p, filters) {
+			txn.Set(p, value)
+		}
+	}
+	return txn.Commit()
+}
+
+// WriteDump writes the dump as JSON to w.
+func WriteDump(w io.Writer, d *Dump) error {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// ReadDump reads a JSON dump written by WriteDump from r.
+func ReadDump(r io.Reader) (d *Dump, err error) {
+	d = &Dump{}
+	if err = json.NewDecoder(r).Decode(d); err != nil {
+		return nil, err
+	}
+	if d.Version < 1 {
+		return nil, NewError(ErrInvalidState, fmt.Sprintf("invalid dump version %d", d.Version))
+	}
+	return
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func dumpSetup(root string) (s Snapshot) {
+	s, err := testDial(root)
+	if err != nil {
+		panic(err)
+	}
+	s.Del("/")
+	s = s.FastForward(-1)
+
+	return
+}
+
+func dumpRegistrySetup() (s Snapshot) {
+	s = dumpSetup("/dump-test")
+
+	r, err := Init(s)
+	if err != nil {
+		panic(err)
+	}
+	s = s.FastForward(r)
+
+	app, err := NewApp("dump-app", "git://dump.git", "stack", s).Register()
+	if err != nil {
+		panic(err)
+	}
+	if _, err = NewRevision(app, "abc123", app.Snapshot).Register(); err != nil {
+		panic(err)
+	}
+	if _, err = NewProcType(app, "web", app.Snapshot).Register(); err != nil {
+		panic(err)
+	}
+	s = s.FastForward(-1)
+
+	ins, err := NewInstance("web", "abc123", "dump-app", "127.0.0.1:9000", s)
+	if err != nil {
+		panic(err)
+	}
+	if _, err = ins.Register(); err != nil {
+		panic(err)
+	}
+	if _, err = CreateTicket("dump-app", "abc123", "web", OpStart, s.FastForward(-1)); err != nil {
+		panic(err)
+	}
+	return s.FastForward(-1)
+}
+
+func TestDumpLoad(t *testing.T) {
+	s := dumpRegistrySetup()
+
+	d, err := DumpSnapshot(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Version != DUMP_VERSION || d.Rev != s.Rev || d.Root != "/dump-test" {
+		t.Errorf("unexpected dump header %#v", d)
+	}
+	if d.Files["/apps/dump-app/registered"] == "" || d.Files[START_PORT_PATH] == "" {
+		t.Errorf("expected apps and next port in dump, got %v", d.Files)
+	}
+
+	buf := &bytes.Buffer{}
+	if err = WriteDump(buf, d); err != nil {
+		t.Fatal(err)
+	}
+	d, err = ReadDump(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := dumpSetup("/dump-load-test")
+	target, err = Load(target, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d1, err := DumpSnapshot(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d1.Files) != len(d.Files) {
+		t.Fatalf("expected %d files, got %d", len(d.Files), len(d1.Files))
+	}
+	for p, v := range d.Files {
+		if d1.Files[p] != v {
+			t.Errorf("expected '%s' at %s, got '%s'", v, p, d1.Files[p])
+		}
+	}
+
+	if _, err = GetApp(target, "dump-app"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDumpLoadFilters(t *testing.T) {
+	d, err := DumpSnapshot(dumpRegistrySetup())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := Load(dumpSetup("/dump-load-test"), d, ExcludeTickets, ExcludeInstances)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{TICKETS_PATH, INSTANCES_PATH, "apps/dump-app/procs/web/instances"} {
+		if exists, _, _ := target.Exists(dir); exists {
+			t.Errorf("expected %s to be excluded", dir)
+		}
+	}
+	if exists, _, _ := target.Exists(START_PORT_PATH); !exists {
+		t.Errorf("expected %s to be restored", START_PORT_PATH)
+	}
+
+	target, err = Load(dumpSetup("/dump-load-test"), d, AppsOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := target.Getdir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != APPS_PATH {
+		t.Errorf("expected only apps to be restored, got %v", names)
+	}
+}
+
+func TestDumpLoadNotEmpty(t *testing.T) {
+	s := dumpRegistrySetup()
+
+	d, err := DumpSnapshot(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Load(s, d); !errors.Is(err, ErrKeyConflict) {
+		t.Errorf("expected ErrKeyConflict, got %v", err)
+	}
+}
+
+func TestDumpLoadNewerVersion(t *testing.T) {
+	d := &Dump{Version: DUMP_VERSION + 1, Files: map[string]string{"/a": "b"}}
+
+	if _, err := Load(dumpSetup("/dump-load-test"), d); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState, got %v", err)
+	}
+}
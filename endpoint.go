@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 )
 
 const ENDPOINTS_PATH = "endpoints"
@@ -25,9 +26,13 @@ type Endpoint struct {
 	Weight   int
 }
 
+// NewEndpoint creates an endpoint for the IPv4 or IPv6 address addr,
+// which may be enclosed in brackets, like "[2001:db8::1]".
 func NewEndpoint(srv *Service, addr string, s Snapshot) (e *Endpoint) {
+	addr = strings.Trim(addr, "[]")
+
 	e = &Endpoint{Addr: addr, Target: addr}
-	e.Path = Path{s, srv.Path.Prefix(ENDPOINTS_PATH, addr)}
+	e.Path = Path{s, srv.Path.Prefix(ENDPOINTS_PATH, endpointName(addr))}
 
 	return
 }
@@ -91,7 +96,8 @@ func (e *Endpoint) Inspect() string {
 // GetEndpoint fetches the endpoint for the given service and addr from the global
 // registry.
 func GetEndpoint(s Snapshot, srv *Service, addr string) (e *Endpoint, err error) {
-	path := srv.Path.Prefix(ENDPOINTS_PATH, addr)
+	addr = strings.Trim(addr, "[]")
+	path := srv.Path.Prefix(ENDPOINTS_PATH, endpointName(addr))
 
 	f, err := s.GetFile(path, new(ListCodec))
 	if err != nil {
@@ -100,7 +106,7 @@ func GetEndpoint(s Snapshot, srv *Service, addr string) (e *Endpoint, err error)
 	data := f.Value.([]string)
 
 	e = &Endpoint{Addr: addr}
-	e.Path = Path{s, srv.Path.Prefix(ENDPOINTS_PATH, addr)}
+	e.Path = Path{s, path}
 
 	p, err := strconv.ParseInt(data[0], 10, 0)
 	if err != nil {
@@ -125,3 +131,15 @@ func GetEndpoint(s Snapshot, srv *Service, addr string) (e *Endpoint, err error)
 
 	return
 }
+
+// endpointName returns the name of the file of the endpoint at addr.
+// Colons aren't valid in paths, so those of IPv6 addresses are replaced
+// with dashes, e.g. "2001-db8--1".
+func endpointName(addr string) string {
+	return strings.Replace(addr, ":", "-", -1)
+}
+
+// endpointAddr returns the address of the endpoint file name.
+func endpointAddr(name string) string {
+	return strings.Replace(name, "-", ":", -1)
+}
@@ -10,7 +10,7 @@ import (
 )
 
 func endpointSetup(srvName string) (s Snapshot, srv *Service) {
-	s, err := Dial(DEFAULT_ADDR, "/endpoint-test")
+	s, err := testDial("/endpoint-test")
 	if err != nil {
 		panic(err)
 	}
@@ -91,3 +91,36 @@ func TestEndpointGet(t *testing.T) {
 		t.Errorf("endpoint missmatch")
 	}
 }
+
+func TestEndpointIPv6(t *testing.T) {
+	s, srv := endpointSetup("sixhoopz")
+	ep := NewEndpoint(srv, "[2001:db8::2]", s)
+
+	if ep.Addr != "2001:db8::2" {
+		t.Errorf("expected addr 2001:db8::2, got %s", ep.Addr)
+	}
+
+	ep, err := ep.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, _, _ := s.conn.Exists(srv.Path.Prefix(ENDPOINTS_PATH, "2001-db8--2")); !exists {
+		t.Error("expected endpoint to be stored as 2001-db8--2")
+	}
+
+	ep2, err := GetEndpoint(ep.Snapshot, srv, "2001:db8::2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep2.Addr != ep.Addr || ep2.Path.Dir != ep.Path.Dir {
+		t.Errorf("expected %s, got %s", ep.Inspect(), ep2.Inspect())
+	}
+
+	eps, err := srv.FastForward(ep.Rev).GetEndpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 1 || eps[0].Addr != ep.Addr {
+		t.Errorf("expected endpoint %s, got %v", ep.Addr, eps)
+	}
+}
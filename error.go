@@ -7,31 +7,120 @@ package visor
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
 	ErrKeyConflict  = errors.New("key is already set")
 	ErrUnauthorized = errors.New("operation is not permitted")
 	ErrInvalidState = errors.New("invalid state")
-	ErrNoEnt        = errors.New("file not found")
+	ErrClosed       = errors.New("connection closed")
+
+	ErrAlreadyClaimed = errors.New("ticket is already claimed")
+)
+
+// Errors reported by the coordinator, one for every doozer error code.
+var (
+	ErrOther       = errors.New("coordinator error")
+	ErrTagInUse    = errors.New("tag in use")
+	ErrUnknownVerb = errors.New("unknown verb")
+	ErrReadonly    = errors.New("coordinator is read-only")
+	ErrTooLate     = errors.New("revision is too old")
+	ErrRevMismatch = errors.New("revision mismatch")
+	ErrBadPath     = errors.New("bad path")
+	ErrMissingArg  = errors.New("missing argument")
+	ErrRange       = errors.New("out of range")
+	ErrNotDir      = errors.New("not a directory")
+	ErrIsDir       = errors.New("is a directory")
+	ErrNoEnt       = errors.New("file not found")
 )
 
+// Error describes a failed operation on the coordinator. Err is usually one
+// of the errors above, so failures can be classified with errors.Is:
+//
+//	if errors.Is(err, visor.ErrRevMismatch) {
+//	    ...
+//	}
 type Error struct {
 	Err     error
 	Message string
+	Op      string // Operation which failed, e.g. "set"
+	Path    string // Path the operation was performed on
+	Rev     int64  // Revision the operation was performed at
+	FileRev int64  // Current file revision, set for ErrRevMismatch
+}
+
+// StateError is returned for a change between two states which isn't
+// allowed. It matches ErrInvalidState with errors.Is.
+type StateError struct {
+	From string
+	To   string
+	Path string
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("%s: invalid state change from '%s' to '%s'", e.Path, e.From, e.To)
+}
+
+// Unwrap returns ErrInvalidState.
+func (e *StateError) Unwrap() error {
+	return ErrInvalidState
 }
 
 func NewError(err error, msg string) *Error {
-	return &Error{err, msg}
+	return &Error{Err: err, Message: msg}
 }
 
 func (e *Error) Error() string {
-	return e.Message
+	if e.Message != "" {
+		return e.Message
+	}
+
+	msg := e.Err.Error()
+	if e.Path != "" {
+		msg = e.Path + ": " + msg
+	}
+	if e.Op != "" {
+		msg = e.Op + " " + msg
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
 }
 
-func IsErrNoEnt(e error) (r bool) {
-	if err, ok := e.(*Error); ok {
-		r = err.Err == ErrNoEnt
+// opError annotates err with the operation, path and revision it occurred at.
+// The fields of errors which are already an *Error are only filled if unset.
+func opError(op string, path string, rev int64, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var e Error
+
+	if ve, ok := err.(*Error); ok {
+		e = *ve
+	} else {
+		e = Error{Err: err}
+	}
+	if e.Op == "" {
+		e.Op = op
 	}
-	return
+	if e.Path == "" {
+		e.Path = path
+	}
+	if e.Rev == 0 {
+		e.Rev = rev
+	}
+	return &e
+}
+
+func IsErrNoEnt(e error) bool {
+	return errors.Is(e, ErrNoEnt)
+}
+
+func IsErrRevMismatch(e error) bool {
+	return errors.Is(e, ErrRevMismatch)
 }
@@ -0,0 +1,103 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"errors"
+	"github.com/soundcloud/doozer"
+	"testing"
+)
+
+func errorSetup() (s Snapshot) {
+	s, err := testDial("/error-test")
+	if err != nil {
+		panic(err)
+	}
+	s.Del("/")
+	s = s.FastForward(-1)
+
+	return
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	err := error(NewError(ErrNoEnt, "not here"))
+
+	if !errors.Is(err, ErrNoEnt) {
+		t.Error("expected error to match ErrNoEnt")
+	}
+	if errors.Is(err, ErrIsDir) {
+		t.Error("expected error not to match ErrIsDir")
+	}
+
+	var e *Error
+	if !errors.As(err, &e) || e.Message != "not here" {
+		t.Error("expected error to be an *Error")
+	}
+}
+
+func TestErrorOpAnnotation(t *testing.T) {
+	s := errorSetup()
+
+	_, _, err := s.Get("missing")
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %T", err)
+	}
+	if e.Op != "get" || e.Path != "/error-test/missing" || e.Rev != s.Rev {
+		t.Errorf("unexpected error fields %#v", e)
+	}
+	if !errors.Is(err, ErrNoEnt) {
+		t.Error("expected error to match ErrNoEnt")
+	}
+}
+
+func TestErrorBackendSentinels(t *testing.T) {
+	s := errorSetup()
+
+	s1, err := s.Set("file", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, err = s1.Set("dir/file", "y")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s1.Getdir("file"); !errors.Is(err, ErrNotDir) {
+		t.Errorf("expected ErrNotDir, got %v", err)
+	}
+	if _, err = s1.Set("dir", "z"); !errors.Is(err, ErrIsDir) {
+		t.Errorf("expected ErrIsDir, got %v", err)
+	}
+	if _, err = s.Set("file", "z"); !errors.Is(err, ErrRevMismatch) {
+		t.Errorf("expected ErrRevMismatch, got %v", err)
+	}
+}
+
+func TestErrorDoozerCodes(t *testing.T) {
+	codes := map[error]error{
+		doozer.ErrOther:    ErrOther,
+		doozer.ErrNotDir:   ErrNotDir,
+		doozer.ErrIsDir:    ErrIsDir,
+		doozer.ErrNoEnt:    ErrNoEnt,
+		doozer.ErrRange:    ErrRange,
+		doozer.ErrOldRev:   ErrRevMismatch,
+		doozer.ErrTooLate:  ErrTooLate,
+		doozer.ErrReadonly: ErrReadonly,
+	}
+
+	for code, sentinel := range codes {
+		err := doozerError(&doozer.Error{Err: code}, "/path")
+		if !errors.Is(err, sentinel) {
+			t.Errorf("expected %s to map to '%s', got '%v'", code, sentinel, err)
+		}
+	}
+
+	if err := doozerError(doozer.ErrClosed, "/path"); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
@@ -6,8 +6,8 @@
 package visor
 
 import (
+	"context"
 	"fmt"
-	"github.com/soundcloud/doozer"
 	"regexp"
 )
 
@@ -17,7 +17,7 @@ type Event struct {
 	Emitter map[string]string // The parsed file path
 	Body    string            // Body of the changed file
 	Info    interface{}       // Extra information, such as InstanceInfo
-	source  *doozer.Event     // Original event returned by doozer
+	source  *Change           // Original change returned by the backend
 	Rev     int64
 }
 
@@ -40,6 +40,8 @@ var EventTypes = map[EventType]string{
 	EvSrvUnreg:  "service-unregister",
 	EvEpReg:     "endpoint-register",
 	EvEpUnreg:   "endpoint-unregister",
+	EvHostReg:   "host-register",
+	EvHostUnreg: "host-unregister",
 }
 
 func (e EventType) String() string {
@@ -68,6 +70,8 @@ const (
 	EvSrvUnreg                   // Service unregister
 	EvEpReg                      // Endpoint register
 	EvEpUnreg                    // Endpoint unregister
+	EvHostReg                    // Host register, a host joined
+	EvHostUnreg                  // Host unregister, a host left
 )
 
 type eventPath int
@@ -80,16 +84,18 @@ const (
 	pathInsState
 	pathSrv
 	pathEp
+	pathHost
 )
 
 var eventPatterns = map[*regexp.Regexp]eventPath{
-	regexp.MustCompile("^/apps/([a-zA-Z0-9-]+)/registered$"):                                pathApp,
-	regexp.MustCompile("^/apps/([a-zA-Z0-9-]+)/revs/([a-zA-Z0-9-]+)/registered$"):           pathRev,
-	regexp.MustCompile("^/apps/([a-zA-Z0-9-]+)/procs/([a-zA-Z0-9-]+)/registered$"):          pathProc,
-	regexp.MustCompile("^/apps/([a-zA-Z0-9-]+)/procs/([a-zA-Z0-9-]+)/instances/([0-9-]+)$"): pathIns,
-	regexp.MustCompile("^/instances/([0-9-]+)/state$"):                                      pathInsState,
-	regexp.MustCompile("^/services/([a-zA-Z0-9-]+)/registered$"):                            pathSrv,
-	regexp.MustCompile("^/services/([a-zA-Z0-9-]+)/endpoints/([0-9\\.]+)$"):                 pathEp,
+	regexp.MustCompile("^/apps/([a-zA-Z0-9-]+)/registered$"):                                      pathApp,
+	regexp.MustCompile("^/apps/([a-zA-Z0-9-]+)/revs/([a-zA-Z0-9-]+)/registered$"):                 pathRev,
+	regexp.MustCompile("^/apps/([a-zA-Z0-9-]+)/procs/([a-zA-Z0-9-]+)/registered$"):                pathProc,
+	regexp.MustCompile("^/apps/([a-zA-Z0-9-]+)/procs/([a-zA-Z0-9-]+)/instances/([0-9a-fA-F-]+)$"): pathIns,
+	regexp.MustCompile("^/instances/([0-9a-fA-F-]+)/state$"):                                      pathInsState,
+	regexp.MustCompile("^/services/([a-zA-Z0-9-]+)/registered$"):                                  pathSrv,
+	regexp.MustCompile("^/services/([a-zA-Z0-9-]+)/endpoints/([0-9a-fA-F\\.-]+)$"):                pathEp,
+	regexp.MustCompile("^/hosts/([a-zA-Z0-9\\.-]+)/registered$"):                                  pathHost,
 }
 
 func (ev *Event) String() string {
@@ -99,25 +105,46 @@ func (ev *Event) String() string {
 // WatchEventRaw watches for changes to the registry and sends
 // them as *Event objects to the provided channel.
 func WatchEventRaw(s Snapshot, listener chan *Event) error {
+	return WatchEventRawContext(context.Background(), s, listener)
+}
+
+// WatchEventRawContext is like WatchEventRaw, but returns ctx.Err()
+// once ctx is done.
+func WatchEventRawContext(ctx context.Context, s Snapshot, listener chan *Event) error {
+	ws := s.conn.waitSession(ctx)
+	defer ws.Close()
+
 	rev := s.Rev
 	for {
-		ev, err := s.conn.Wait("**", rev+1)
+		ev, err := ws.Wait("**", rev+1)
 		if err != nil {
 			return err
 		}
 		rev = ev.Rev
 		event := parseEvent(&ev)
 
-		listener <- event
+		select {
+		case listener <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-	return nil
 }
 
 // WatchEvent wraps WatchEventRaw with additional information.
 func WatchEvent(s Snapshot, listener chan *Event) error {
+	return WatchEventContext(context.Background(), s, listener)
+}
+
+// WatchEventContext is like WatchEvent, but returns ctx.Err()
+// once ctx is done.
+func WatchEventContext(ctx context.Context, s Snapshot, listener chan *Event) error {
+	ws := s.conn.waitSession(ctx)
+	defer ws.Close()
+
 	rev := s.Rev
 	for {
-		ev, err := s.conn.Wait("**", rev+1)
+		ev, err := ws.Wait("**", rev+1)
 		if err != nil {
 			return err
 		}
@@ -131,9 +158,12 @@ func WatchEvent(s Snapshot, listener chan *Event) error {
 			continue
 		}
 
-		listener <- event
+		select {
+		case listener <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-	return nil
 }
 
 func GetEventInfo(s Snapshot, ev *Event) (info interface{}, err error) {
@@ -216,11 +246,18 @@ func GetEventInfo(s Snapshot, ev *Event) (info interface{}, err error) {
 		if err != nil {
 			fmt.Printf("error getting endpoint: %s\n", err)
 		}
+	case EvHostReg:
+		info, err = GetHost(s, ev.Emitter["host"])
+
+		if err != nil {
+			fmt.Printf("error getting host: %s\n", err)
+			return
+		}
 	}
 	return
 }
 
-func parseEvent(src *doozer.Event) *Event {
+func parseEvent(src *Change) *Event {
 	path := src.Path
 
 	etype := EventType(-1)
@@ -292,13 +329,21 @@ func parseEvent(src *doozer.Event) *Event {
 				}
 			case pathEp:
 				emitter["service"] = match[1]
-				emitter["endpoint"] = match[2]
+				emitter["endpoint"] = endpointAddr(match[2])
 
 				if src.IsSet() {
 					etype = EvEpReg
 				} else if src.IsDel() {
 					etype = EvEpUnreg
 				}
+			case pathHost:
+				emitter["host"] = match[1]
+
+				if src.IsSet() {
+					etype = EvHostReg
+				} else if src.IsDel() {
+					etype = EvHostUnreg
+				}
 			}
 			break
 		}
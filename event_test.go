@@ -6,12 +6,15 @@
 package visor
 
 import (
+	"context"
+	"errors"
+	"runtime"
 	"testing"
 	"time"
 )
 
 func eventSetup() (s Snapshot, l chan *Event) {
-	s, err := Dial(DEFAULT_ADDR, "/event-test")
+	s, err := testDial("/event-test")
 	if err != nil {
 		panic(err)
 	}
@@ -198,6 +201,28 @@ func TestEventInstanceRegistered(t *testing.T) {
 	expectEvent(EvInsReg, emitter, l, t)
 }
 
+func TestEventInstanceIPv6(t *testing.T) {
+	s, l := eventSetup()
+	ins, _ := NewInstance("web-six", "stable-six", "sixmouse", "[2001:db8::1]:8080", s)
+	emitter := map[string]string{"instance": "2001-db8--1-8080", "app": "sixmouse", "proctype": "web-six"}
+
+	ins, err := ins.Register()
+	if err != nil {
+		t.Error(err)
+	}
+
+	s = s.FastForward(ins.Rev)
+
+	go WatchEvent(s, l)
+
+	_, err = ins.UpdateState(InsStateStarted)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectEvent(EvInsStart, emitter, l, t)
+}
+
 func TestEventInstanceUnregistered(t *testing.T) {
 	s, l := eventSetup()
 	ins, _ := NewInstance("web", "stable", "unregmouse", "127.0.0.1:8080", s)
@@ -308,6 +333,21 @@ func TestEventEpRegistered(t *testing.T) {
 	expectEvent(EvEpReg, map[string]string{"service": "eventep", "endpoint": "1.2.3.4"}, l, t)
 }
 
+func TestEventEpRegisteredIPv6(t *testing.T) {
+	s, l := eventSetup()
+	srv := NewService("eventsixep", s)
+	ep := NewEndpoint(srv, "[2001:db8::3]", s)
+
+	go WatchEvent(s, l)
+
+	ep, err := ep.Register()
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectEvent(EvEpReg, map[string]string{"service": "eventsixep", "endpoint": "2001:db8::3"}, l, t)
+}
+
 func TestEventEpUnregistered(t *testing.T) {
 	s, l := eventSetup()
 	srv := NewService("eventunep", s)
@@ -330,6 +370,94 @@ func TestEventEpUnregistered(t *testing.T) {
 	expectEvent(EvEpUnreg, map[string]string{"service": "eventunep", "endpoint": "4.3.2.1"}, l, t)
 }
 
+func TestEventHostRegistered(t *testing.T) {
+	s, l := eventSetup()
+	h := NewHost("box-7.example.com", 4, 1024, s)
+
+	go WatchEvent(s, l)
+
+	h, err := h.Register()
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectEvent(EvHostReg, map[string]string{"host": "box-7.example.com"}, l, t)
+}
+
+func TestEventHostUnregistered(t *testing.T) {
+	s, l := eventSetup()
+	h := NewHost("box-8", 4, 1024, s)
+
+	h, err := h.Register()
+	if err != nil {
+		t.Error(err)
+	}
+
+	s = s.FastForward(h.Rev)
+
+	go WatchEvent(s, l)
+
+	err = h.Unregister()
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectEvent(EvHostUnreg, map[string]string{"host": "box-8"}, l, t)
+}
+
+func TestEventWatchContextCancel(t *testing.T) {
+	s, l := eventSetup()
+	n := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() { done <- WatchEventContext(ctx, s, l) }()
+
+	_, err := eventAppSetup("ctxcat", s).Register()
+	if err != nil {
+		t.Error(err)
+	}
+	expectEvent(EvAppReg, map[string]string{"app": "ctxcat"}, l, t)
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("watch didn't return after cancel")
+	}
+	expectGoroutines(n, t)
+}
+
+func TestEventWatchContextBlockedListener(t *testing.T) {
+	s, l := eventSetup()
+	n := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() { done <- WatchEventRawContext(ctx, s, l) }()
+
+	// Nobody reads from l, the watch blocks sending the event.
+	_, err := eventAppSetup("blockedcat", s).Register()
+	if err != nil {
+		t.Error(err)
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("watch didn't return after cancel")
+	}
+	expectGoroutines(n, t)
+}
+
 func expectEvent(etype EventType, emitterMap map[string]string, l chan *Event, t *testing.T) {
 	for {
 		select {
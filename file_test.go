@@ -10,7 +10,7 @@ import (
 )
 
 func fileSetup(path string, value interface{}) *File {
-	s, err := Dial(DEFAULT_ADDR, "/file-test")
+	s, err := testDial("/file-test")
 	if err != nil {
 		panic(err)
 	}
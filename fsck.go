@@ -0,0 +1,251 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// Kinds of problems found by Fsck.
+const (
+	FsckDanglingInstance = "dangling-instance" // Proctype instance link without an instance
+	FsckUnknownProcType  = "unknown-proctype"  // Scale factor for an unregistered proctype
+	FsckBadAttrs         = "bad-attrs"         // App attrs GetApp can't read
+	FsckStuckTicket      = "stuck-ticket"      // Ticket claimed by nobody, or claimed for too long
+)
+
+// appAttrs are the keys of the app attrs read by GetApp.
+var appAttrs = []string{"repo-url", "stack", "deploy-type"}
+
+// FsckProblem is an inconsistency in the coordinator tree. Repairable
+// problems can be fixed by FsckRepair without losing information.
+type FsckProblem struct {
+	Kind       string
+	Path       string
+	Message    string
+	Repairable bool
+}
+
+func (p FsckProblem) String() string {
+	return fmt.Sprintf("%s %s: %s", p.Kind, p.Path, p.Message)
+}
+
+// Fsck checks the coordinator tree at the snapshot's revision and returns
+// the problems found. Tickets claimed longer than claimTimeout ago are
+// reported as stuck, unless claimTimeout is 0.
+func Fsck(s Snapshot, claimTimeout time.Duration) (problems []FsckProblem, err error) {
+	problems = []FsckProblem{}
+
+	apps, err := fsckGetdir(s, APPS_PATH)
+	if err != nil {
+		return
+	}
+	for _, app := range apps {
+		var p []FsckProblem
+
+		if p, err = fsckApp(s, app); err != nil {
+			return
+		}
+		problems = append(problems, p...)
+	}
+
+	tickets, err := fsckGetdir(s, TICKETS_PATH)
+	if err != nil {
+		return
+	}
+	for _, id := range tickets {
+		var p []FsckProblem
+
+		if p, err = fsckTicket(s, id, claimTimeout); err != nil {
+			return
+		}
+		problems = append(problems, p...)
+	}
+	return
+}
+
+func fsckApp(s Snapshot, app string) (problems []FsckProblem, err error) {
+	attrsPath := path.Join(APPS_PATH, app, "attrs")
+
+	attrs, _, err := s.GetBytes(attrsPath)
+	if err != nil && !IsErrNoEnt(err) {
+		return
+	}
+	if msg := checkAttrs(attrs, err); msg != "" {
+		problems = append(problems, FsckProblem{Kind: FsckBadAttrs, Path: attrsPath, Message: msg})
+	}
+
+	procs, err := fsckGetdir(s, path.Join(APPS_PATH, app, PROCS_PATH))
+	if err != nil {
+		return
+	}
+	registered := map[string]bool{}
+
+	for _, proc := range procs {
+		registered[proc] = true
+
+		dir := path.Join(APPS_PATH, app, PROCS_PATH, proc, INSTANCES_PATH)
+		ids, e := fsckGetdir(s, dir)
+		if e != nil {
+			return nil, e
+		}
+		for _, id := range ids {
+			exists, _, e := s.Exists(path.Join(INSTANCES_PATH, id))
+			if e != nil {
+				return nil, e
+			}
+			if !exists {
+				problems = append(problems, FsckProblem{
+					Kind:       FsckDanglingInstance,
+					Path:       path.Join(dir, id),
+					Message:    fmt.Sprintf("instance %s doesn't exist", id),
+					Repairable: true,
+				})
+			}
+		}
+	}
+
+	revs, err := fsckGetdir(s, path.Join(APPS_PATH, app, REVS_PATH))
+	if err != nil {
+		return
+	}
+	for _, rev := range revs {
+		dir := path.Join(APPS_PATH, app, REVS_PATH, rev, SCALE_PATH)
+		scaled, e := fsckGetdir(s, dir)
+		if e != nil {
+			return nil, e
+		}
+		for _, proc := range scaled {
+			if !registered[proc] {
+				problems = append(problems, FsckProblem{
+					Kind:    FsckUnknownProcType,
+					Path:    path.Join(dir, proc),
+					Message: fmt.Sprintf("proctype %s of app %s isn't registered", proc, app),
+				})
+			}
+		}
+	}
+	return problems, nil
+}
+
+// checkAttrs returns why attrs can't be read by GetApp, if at all.
+func checkAttrs(attrs []byte, err error) string {
+	if err != nil {
+		return "attrs are missing"
+	}
+
+	value := map[string]interface{}{}
+	if err = json.Unmarshal(attrs, &value); err != nil {
+		return fmt.Sprintf("attrs are invalid: %s", err)
+	}
+
+	missing := []string{}
+	for _, key := range appAttrs {
+		if _, ok := value[key].(string); !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Sprintf("attrs are missing %s", strings.Join(missing, ", "))
+	}
+	return ""
+}
+
+func fsckTicket(s Snapshot, id string, claimTimeout time.Duration) (problems []FsckProblem, err error) {
+	statusPath := path.Join(TICKETS_PATH, id, "status")
+
+	status, _, err := s.Get(statusPath)
+	if IsErrNoEnt(err) {
+		return nil, nil
+	}
+	if err != nil || TicketStatus(status) != TicketStatusClaimed {
+		return
+	}
+
+	dir := path.Join(TICKETS_PATH, id, "claims")
+	hosts, err := fsckGetdir(s, dir)
+	if err != nil {
+		return
+	}
+	if len(hosts) == 0 {
+		problems = append(problems, FsckProblem{
+			Kind:       FsckStuckTicket,
+			Path:       statusPath,
+			Message:    "ticket is claimed, but not by any host",
+			Repairable: true,
+		})
+		return
+	}
+	if claimTimeout <= 0 {
+		return
+	}
+
+	var latest time.Time
+
+	for _, host := range hosts {
+		value, _, e := s.Get(path.Join(dir, host))
+		if e != nil {
+			return nil, e
+		}
+		if t, e := time.Parse(timeLayout, value); e == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	if age := time.Since(latest); age > claimTimeout {
+		problems = append(problems, FsckProblem{
+			Kind:    FsckStuckTicket,
+			Path:    statusPath,
+			Message: fmt.Sprintf("ticket is claimed by %s since %s", strings.Join(hosts, ", "), age),
+		})
+	}
+	return
+}
+
+func fsckGetdir(s Snapshot, dir string) (names []string, err error) {
+	names, err = s.Getdir(dir)
+	if IsErrNoEnt(err) {
+		return []string{}, nil
+	}
+	return
+}
+
+// FsckRepair fixes the repairable problems found by Fsck at the snapshot's
+// revision: dangling instance links are removed and tickets claimed by
+// nobody are unclaimed. The repairs are applied all-or-nothing and fail
+// if any of the files changed after the snapshot. It returns the
+// repaired problems.
+func FsckRepair(s Snapshot, problems []FsckProblem) (s1 Snapshot, repaired []FsckProblem, err error) {
+	txn := s.Txn()
+	repaired = []FsckProblem{}
+
+	for _, p := range problems {
+		if !p.Repairable {
+			continue
+		}
+		switch p.Kind {
+		case FsckDanglingInstance:
+			txn.Del(p.Path)
+		case FsckStuckTicket:
+			t := &Ticket{Path: Path{s, path.Dir(p.Path)}}
+			if _, err = t.transition(s, txn, TicketStatusUnClaimed, "", time.Now().UTC()); err != nil {
+				return s, nil, err
+			}
+		default:
+			continue
+		}
+		repaired = append(repaired, p)
+	}
+
+	s1, err = txn.Commit()
+	if err != nil {
+		return s, nil, err
+	}
+	return
+}
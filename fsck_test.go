@@ -0,0 +1,149 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"testing"
+	"time"
+)
+
+func fsckSetup() (s Snapshot) {
+	s, err := testDial("/fsck-test")
+	if err != nil {
+		panic(err)
+	}
+	s.Del("/")
+	s = s.FastForward(-1)
+
+	r, err := Init(s)
+	if err != nil {
+		panic(err)
+	}
+	s = s.FastForward(r)
+
+	app, err := NewApp("fsck-app", "git://fsck.git", "stack", s).Register()
+	if err != nil {
+		panic(err)
+	}
+	if _, err = NewProcType(app, "web", app.Snapshot).Register(); err != nil {
+		panic(err)
+	}
+	return s.FastForward(-1)
+}
+
+func fsckKinds(problems []FsckProblem) map[string]FsckProblem {
+	kinds := map[string]FsckProblem{}
+	for _, p := range problems {
+		kinds[p.Kind] = p
+	}
+	return kinds
+}
+
+func TestFsckClean(t *testing.T) {
+	s := fsckSetup()
+
+	ins, err := NewInstance("web", "abc123", "fsck-app", "127.0.0.1:9000", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ins.Register(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = CreateTicket("fsck-app", "abc123", "web", OpStart, s); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := Fsck(s.FastForward(-1), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
+
+func TestFsckProblems(t *testing.T) {
+	s := fsckSetup()
+	old := time.Now().Add(-2 * time.Hour).UTC().String()
+
+	for p, v := range map[string]string{
+		"apps/fsck-app/procs/web/instances/1-2-3-4-5": "link",
+		"apps/fsck-app/revs/abc123/scale/worker":      "1",
+		"apps/broken-app/attrs":                       `{"stack": "stack"}`,
+		"tickets/1/status":                            string(TicketStatusClaimed),
+		"tickets/2/status":                            string(TicketStatusClaimed),
+		"tickets/2/claims/host":                       old,
+	} {
+		s1, err := s.Set(p, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s = s1
+	}
+
+	problems, err := Fsck(s, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 5 {
+		t.Fatalf("expected 5 problems, got %v", problems)
+	}
+
+	kinds := fsckKinds(problems)
+	for kind, p := range map[string]string{
+		FsckDanglingInstance: "apps/fsck-app/procs/web/instances/1-2-3-4-5",
+		FsckUnknownProcType:  "apps/fsck-app/revs/abc123/scale/worker",
+		FsckBadAttrs:         "apps/broken-app/attrs",
+	} {
+		if kinds[kind].Path != p {
+			t.Errorf("expected %s at %s, got %v", kind, p, kinds[kind])
+		}
+	}
+
+	if problems, _ = Fsck(s, 0); len(problems) != 4 {
+		t.Errorf("expected claim age not to be checked, got %v", problems)
+	}
+}
+
+func TestFsckRepair(t *testing.T) {
+	s := fsckSetup()
+
+	for p, v := range map[string]string{
+		"apps/fsck-app/procs/web/instances/1-2-3-4-5": "link",
+		"apps/fsck-app/revs/abc123/scale/worker":      "1",
+		"tickets/1/status":                            string(TicketStatusClaimed),
+	} {
+		s1, err := s.Set(p, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s = s1
+	}
+
+	problems, err := Fsck(s, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, repaired, err := FsckRepair(s, problems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repaired) != 2 {
+		t.Errorf("expected 2 repaired problems, got %v", repaired)
+	}
+
+	if status, _, _ := s.Get("tickets/1/status"); TicketStatus(status) != TicketStatusUnClaimed {
+		t.Errorf("expected ticket to be unclaimed, got '%s'", status)
+	}
+
+	problems, err = Fsck(s, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Kind != FsckUnknownProcType {
+		t.Errorf("expected only the unknown proctype to be left, got %v", problems)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TicketGC selects the finished tickets removed by CollectTickets. A
+// ticket is removed if it finished longer than OlderThan ago, or if
+// it isn't among the Keep most recent ones. Zero values disable the
+// respective limit, so the zero TicketGC removes nothing.
+type TicketGC struct {
+	OlderThan time.Duration
+	Keep      int
+	Status    []TicketStatus // Final statuses, all of them if empty
+}
+
+// CollectTickets removes done, dead and cancelled tickets selected by
+// gc, along with their entries in the dead-letter area. Unclaimed and
+// claimed tickets, and tickets waiting for a retry, are never removed.
+// Tickets which finished before the time was recorded count as
+// finished long ago. Each ticket is removed all-or-nothing, and left alone if it
+// changed concurrently. It returns the removed tickets.
+func CollectTickets(s Snapshot, gc TicketGC) (removed []*Ticket, err error) {
+	s = s.FastForward(-1)
+	removed = []*Ticket{}
+
+	statuses := gc.Status
+	if len(statuses) == 0 {
+		statuses = []TicketStatus{TicketStatusDone, TicketStatusDead, TicketStatusCancelled}
+	}
+	for _, status := range statuses {
+		if !status.Final() {
+			return removed, NewError(ErrInvalidState, fmt.Sprintf("can't collect tickets with status '%s'", status))
+		}
+	}
+
+	finished, err := finishedTickets(s, statuses)
+	if err != nil {
+		return
+	}
+	deadline := time.Now().Add(-gc.OlderThan)
+
+	for i, t := range finished {
+		expired := gc.OlderThan > 0 && t.Finished.Before(deadline)
+		excess := gc.Keep > 0 && i >= gc.Keep
+
+		if !expired && !excess {
+			continue
+		}
+
+		err = t.remove(s)
+		if errors.Is(err, ErrRevMismatch) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		removed = append(removed, t)
+	}
+	return removed, nil
+}
+
+// finishedTickets returns the tickets with one of the statuses,
+// the most recently created first.
+func finishedTickets(s Snapshot, statuses []TicketStatus) (tickets []*Ticket, err error) {
+	ids, err := ticketIds(s)
+	if err != nil {
+		return
+	}
+	sort.Sort(sort.Reverse(int64s(ids)))
+
+	for _, id := range ids {
+		var t *Ticket
+
+		t, err = GetTicket(s, id)
+		if IsErrNoEnt(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		for _, status := range statuses {
+			if t.Status == status {
+				tickets = append(tickets, t)
+				break
+			}
+		}
+	}
+	return tickets, nil
+}
+
+// remove deletes all files of the ticket at the snapshot's revision.
+// The status is deleted first, so that backends without atomic
+// batches fail before deleting anything if it changed.
+func (t *Ticket) remove(s Snapshot) error {
+	files := []string{path.Join("/", t.Path.Prefix("status"))}
+
+	err := dumpDir(s, path.Join("/", t.Path.Dir), func(p string, value []byte) {
+		if p != files[0] {
+			files = append(files, p)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	txn := s.Txn()
+	for _, p := range files {
+		txn.Del(p)
+	}
+
+	deadPath := path.Join("/", DEAD_TICKETS_PATH, strconv.FormatInt(t.Id, 10))
+	exists, _, err := s.Exists(deadPath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		txn.Del(deadPath)
+	}
+
+	_, err = txn.Commit()
+	return err
+}
+
+type int64s []int64
+
+func (a int64s) Len() int           { return len(a) }
+func (a int64s) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a int64s) Less(i, j int) bool { return a[i] < a[j] }
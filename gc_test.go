@@ -0,0 +1,142 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// gcSetup creates an unclaimed, a claimed, a dead and two done tickets,
+// in this order.
+func gcSetup() (s Snapshot, tickets []*Ticket) {
+	s, err := testDial("/gc-test")
+	if err != nil {
+		panic(err)
+	}
+	s.conn.Del("/", s.Rev)
+	s = s.FastForward(-1)
+
+	for i := 0; i < 5; i++ {
+		t := &Ticket{AppName: "gc", RevisionName: "abc", ProcessName: "web", Op: OpStart, Status: TicketStatusUnClaimed, MaxAttempts: 1, Path: Path{s, ""}}
+		if t, err = t.Create(); err != nil {
+			panic(err)
+		}
+		if i > 0 {
+			if t, err = t.Claim("host-a"); err != nil {
+				panic(err)
+			}
+		}
+		switch i {
+		case 2:
+			t, err = t.Fail("host-a", "boom")
+		case 3, 4:
+			err = t.Done("host-a", nil)
+		}
+		if err != nil {
+			panic(err)
+		}
+		s = s.FastForward(-1)
+		tickets = append(tickets, t)
+	}
+	return
+}
+
+func expectTicketsExist(s Snapshot, tickets []*Ticket, expected []bool, t *testing.T) {
+	for i, ticket := range tickets {
+		exists, _, err := s.FastForward(-1).Exists(ticket.Path.Dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != expected[i] {
+			t.Errorf("expected ticket %d to exist: %v, got %v", i, expected[i], exists)
+		}
+	}
+}
+
+func TestCollectTicketsOlderThan(t *testing.T) {
+	s, tickets := gcSetup()
+
+	removed, err := CollectTickets(s, TicketGC{OlderThan: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("expected no tickets to be removed, got %v", removed)
+	}
+
+	// Finished two hours ago.
+	if _, err = tickets[3].FastForward(-1).Set("finished", time.Now().Add(-2*time.Hour).UTC().String()); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err = CollectTickets(s, TicketGC{OlderThan: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Id != tickets[3].Id {
+		t.Errorf("expected ticket %d to be removed, got %v", tickets[3].Id, removed)
+	}
+	expectTicketsExist(s, tickets, []bool{true, true, true, false, true}, t)
+}
+
+func TestCollectTicketsKeep(t *testing.T) {
+	s, tickets := gcSetup()
+
+	removed, err := CollectTickets(s, TicketGC{Keep: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("expected 2 tickets to be removed, got %v", removed)
+	}
+	expectTicketsExist(s, tickets, []bool{true, true, false, false, true}, t)
+
+	dead, err := DeadTickets(s.FastForward(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 0 {
+		t.Errorf("expected dead-letter area to be empty, got %v", dead)
+	}
+}
+
+func TestCollectTicketsStatus(t *testing.T) {
+	s, tickets := gcSetup()
+
+	removed, err := CollectTickets(s, TicketGC{OlderThan: time.Nanosecond, Status: []TicketStatus{TicketStatusDead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Id != tickets[2].Id {
+		t.Errorf("expected ticket %d to be removed, got %v", tickets[2].Id, removed)
+	}
+	expectTicketsExist(s, tickets, []bool{true, true, false, true, true}, t)
+
+	_, err = CollectTickets(s, TicketGC{Keep: 1, Status: []TicketStatus{TicketStatusClaimed}})
+	if !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState, got %v", err)
+	}
+	expectTicketsExist(s, tickets, []bool{true, true, false, true, true}, t)
+}
+
+func TestCollectTicketsCancelled(t *testing.T) {
+	s, tickets := gcSetup()
+
+	cancelled, err := tickets[0].Cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = s.FastForward(-1)
+
+	removed, err := CollectTickets(s, TicketGC{OlderThan: time.Nanosecond, Status: []TicketStatus{TicketStatusCancelled}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Id != cancelled.Id {
+		t.Errorf("expected ticket %d to be removed, got %v", cancelled.Id, removed)
+	}
+	expectTicketsExist(s, tickets, []bool{false, true, true, true, true}, t)
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const HOSTS_PATH = "hosts"
+
+// hostName matches the names hosts can register with, the same ones
+// host events are emitted for.
+var hostName = regexp.MustCompile("^[a-zA-Z0-9\\.-]+$")
+
+// Host is a machine which runs instances. Slots is the number of
+// instances it can run, Memory its memory in megabytes.
+type Host struct {
+	Path
+	Name   string
+	Slots  int
+	Memory int
+	Labels map[string]string
+}
+
+// hostAttrs is the JSON representation of the host attrs.
+type hostAttrs struct {
+	Slots  int               `json:"slots"`
+	Memory int               `json:"memory"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// NewHost returns a new Host given a name, usually its hostname.
+func NewHost(name string, slots int, memory int, snapshot Snapshot) (h *Host) {
+	h = &Host{Name: name, Slots: slots, Memory: memory, Labels: map[string]string{}}
+	h.Path = Path{snapshot, path.Join(HOSTS_PATH, h.Name)}
+
+	return
+}
+
+func (h *Host) createSnapshot(rev int64) Snapshotable {
+	tmp := *h
+	tmp.Snapshot = Snapshot{rev, h.conn}
+	return &tmp
+}
+
+// FastForward advances the host in time. It returns
+// a new instance of Host with the supplied revision.
+func (h *Host) FastForward(rev int64) *Host {
+	return h.Snapshot.fastForward(h, rev).(*Host)
+}
+
+// Register adds the Host to the global process state, which emits EvHostReg.
+// Host names consist of letters, digits, dots and dashes.
+func (h *Host) Register() (host *Host, err error) {
+	if !hostName.MatchString(h.Name) || h.Name == "." || h.Name == ".." {
+		return nil, NewError(ErrBadPath, fmt.Sprintf("invalid host name '%s'", h.Name))
+	}
+
+	exists, _, err := h.conn.Exists(h.Path.Dir)
+	if err != nil {
+		return
+	}
+	if exists {
+		return nil, ErrKeyConflict
+	}
+
+	attrs, err := json.Marshal(hostAttrs{h.Slots, h.Memory, h.Labels})
+	if err != nil {
+		return
+	}
+
+	txn := h.Snapshot.Txn()
+	txn.SetBytes(h.Path.Prefix("attrs"), attrs)
+	txn.Set(h.Path.Prefix("registered"), time.Now().UTC().String())
+
+	s, err := txn.Commit()
+	if err != nil {
+		return
+	}
+
+	host = h.FastForward(s.Rev)
+
+	return
+}
+
+// Unregister removes the Host from the global process state,
+// which emits EvHostUnreg.
+func (h *Host) Unregister() error {
+	return h.Del("/")
+}
+
+// Heartbeat records that the host is alive.
+func (h *Host) Heartbeat() (host *Host, err error) {
+	newrev, err := h.conn.Set(h.Path.Prefix("heartbeat"), -1, []byte(time.Now().UTC().String()))
+	if err != nil {
+		return
+	}
+	host = h.FastForward(newrev)
+
+	return
+}
+
+// LastHeartbeat returns the time of the host's last heartbeat. It
+// fails with ErrNoEnt if the host never sent one.
+func (h *Host) LastHeartbeat() (t time.Time, err error) {
+	value, _, err := h.Get("heartbeat")
+	if err != nil {
+		return
+	}
+	return time.Parse(timeLayout, value)
+}
+
+// Registered returns the time the host was registered at.
+func (h *Host) Registered() (t time.Time, err error) {
+	value, _, err := h.Get("registered")
+	if err != nil {
+		return
+	}
+	return time.Parse(timeLayout, value)
+}
+
+// LabelString returns the labels of the host as a sorted,
+// comma separated list of key=value pairs.
+func (h *Host) LabelString() string {
+	pairs := []string{}
+	for k, v := range h.Labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func (h *Host) String() string {
+	return fmt.Sprintf("Host<%s>", h.Name)
+}
+
+func (h *Host) Inspect() string {
+	return fmt.Sprintf("%#v", h)
+}
+
+// GetHost fetches a host with the given name.
+func GetHost(s Snapshot, name string) (h *Host, err error) {
+	h = NewHost(name, 0, 0, s)
+
+	value, _, err := s.GetBytes(h.Path.Prefix("attrs"))
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := hostAttrs{}
+	if err = json.Unmarshal(value, &attrs); err != nil {
+		return nil, NewError(ErrInvalidState, fmt.Sprintf("invalid attrs for host %s: %s", name, err))
+	}
+
+	h.Slots = attrs.Slots
+	h.Memory = attrs.Memory
+	if attrs.Labels != nil {
+		h.Labels = attrs.Labels
+	}
+
+	return
+}
+
+// Hosts returns the list of all registered Hosts.
+func Hosts(s Snapshot) (hosts []*Host, err error) {
+	hosts = []*Host{}
+
+	names, err := fsckGetdir(s, HOSTS_PATH)
+	if err != nil {
+		return
+	}
+
+	for _, name := range names {
+		var h *Host
+
+		h, err = GetHost(s, name)
+		if err != nil {
+			return
+		}
+
+		hosts = append(hosts, h)
+	}
+
+	return
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func hostSetup(name string) (h *Host) {
+	s, err := testDial("/host-test")
+	if err != nil {
+		panic(err)
+	}
+
+	r, _ := s.conn.Rev()
+	err = s.conn.Del(HOSTS_PATH, r)
+
+	h = NewHost(name, 8, 4096, s.FastForward(-1))
+	h.Labels = map[string]string{"zone": "eu", "disk": "ssd"}
+
+	return
+}
+
+func TestHostRegistration(t *testing.T) {
+	h := hostSetup("box-1.example.com")
+
+	h2, err := h.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, _, err := h2.conn.Exists(h2.Path.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check {
+		t.Error("Host registration failed")
+	}
+	if _, err = h2.Register(); !errors.Is(err, ErrKeyConflict) {
+		t.Errorf("expected ErrKeyConflict, got %v", err)
+	}
+
+	h3, err := GetHost(h2.Snapshot, h.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h3.Slots != 8 || h3.Memory != 4096 {
+		t.Errorf("expected 8 slots and 4096MB, got %d and %dMB", h3.Slots, h3.Memory)
+	}
+	if h3.LabelString() != "disk=ssd,zone=eu" {
+		t.Errorf("expected labels disk=ssd,zone=eu, got %s", h3.LabelString())
+	}
+}
+
+func TestHostRegisterInvalidName(t *testing.T) {
+	for _, name := range []string{"", "web_1", "a/b", "box 1", "..", "box:1"} {
+		h := hostSetup(name)
+
+		if _, err := h.Register(); !errors.Is(err, ErrBadPath) {
+			t.Errorf("expected ErrBadPath for '%s', got %v", name, err)
+		}
+	}
+}
+
+func TestHostUnregistration(t *testing.T) {
+	h := hostSetup("box-2")
+
+	h, err := h.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = h.Unregister(); err != nil {
+		t.Fatal(err)
+	}
+
+	check, _, err := h.conn.Exists(h.Path.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check {
+		t.Error("Host still registered")
+	}
+}
+
+func TestHostHeartbeat(t *testing.T) {
+	h := hostSetup("box-3")
+
+	h, err := h.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = h.LastHeartbeat(); !IsErrNoEnt(err) {
+		t.Errorf("expected ErrNoEnt, got %v", err)
+	}
+
+	h, err = h.Heartbeat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := h.LastHeartbeat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(last) > time.Minute {
+		t.Errorf("expected recent heartbeat, got %s", last)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	h := hostSetup("box-4")
+	names := map[string]bool{"box-4": true, "box-5": true}
+
+	h, err := h.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h5, err := NewHost("box-5", 1, 512, h.Snapshot).Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := Hosts(h5.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != len(names) {
+		t.Fatalf("expected %d hosts, got %d", len(names), len(hosts))
+	}
+	for _, h := range hosts {
+		if !names[h.Name] {
+			t.Errorf("unexpected host %s", h.Name)
+		}
+	}
+}
+
+func TestHostsBeforeRegistration(t *testing.T) {
+	h := hostSetup("box-6")
+	before := h.Snapshot
+
+	if _, err := h.Register(); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := Hosts(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 0 {
+		t.Errorf("expected no hosts, got %v", hosts)
+	}
+}
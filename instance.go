@@ -6,6 +6,8 @@
 package visor
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"path"
@@ -22,8 +24,20 @@ const (
 	InsStateExited        = "exited"
 )
 
+// insTransitions holds the states an instance may change to from each state.
+var insTransitions = map[State][]State{
+	InsStateInitial: {InsStateStarted, InsStateFailed, InsStateExited, InsStateDead},
+	InsStateStarted: {InsStateFailed, InsStateExited, InsStateDead},
+	InsStateFailed:  {InsStateStarted, InsStateExited, InsStateDead},
+	InsStateExited:  {InsStateDead},
+	InsStateDead:    {},
+}
+
 const INSTANCES_PATH = "instances"
 
+// INSTANCE_INFO_VERSION is the version of the InstanceInfo document.
+const INSTANCE_INFO_VERSION = 1
+
 // An Instance represents a running process of a specific type.
 type Instance struct {
 	Path
@@ -35,6 +49,28 @@ type Instance struct {
 	Host         string
 	Port         int
 	State        State
+	Pid          int
+	Hostname     string
+	StartTime    time.Time
+	ExitStatus   *int // nil until the process exited
+	Labels       map[string]string
+}
+
+// InstanceInfo is the JSON document stored in the info file of an instance.
+// Older registries store the space-separated fields of (*Instance).String
+// instead, which are read as version 0.
+type InstanceInfo struct {
+	Version    int               `json:"version"`
+	App        string            `json:"app"`
+	Revision   string            `json:"rev"`
+	Proc       string            `json:"proc"`
+	Host       string            `json:"host"`
+	Port       int               `json:"port"`
+	Pid        int               `json:"pid,omitempty"`
+	Hostname   string            `json:"hostname,omitempty"`
+	StartTime  *time.Time        `json:"start-time,omitempty"`
+	ExitStatus *int              `json:"exit-status,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
 }
 
 // NewInstance creates and returns a new Instance object.
@@ -85,17 +121,20 @@ func (i *Instance) Register() (instance *Instance, err error) {
 		return nil, ErrKeyConflict
 	}
 
-	_, err = i.Set("info", i.String())
+	info, err := json.Marshal(i.Info())
 	if err != nil {
-		return i, err
+		return
 	}
-	_, err = i.Set("state", string(i.State))
+
+	txn := i.Snapshot.Txn()
+	txn.SetBytes(i.Path.Prefix("info"), info)
+	txn.Set(i.Path.Prefix("state"), string(i.State))
+	txn.Set(i.ProctypePath(), time.Now().UTC().String())
+
+	s, err := txn.Commit()
 	if err != nil {
 		return i, err
 	}
-	now := time.Now().UTC().String()
-
-	s, err := i.Snapshot.Set(i.ProctypePath(), now)
 	instance = i.FastForward(s.Rev)
 
 	return
@@ -111,21 +150,245 @@ func (i *Instance) Unregister() (err error) {
 	return
 }
 
-// UpdateState updates the instance's state file in
-// the coordinator to the given value.
+// UpdateState updates the instance's state file in the coordinator to
+// the given value. It fails with a *StateError if the instance can't
+// change from its current state in the coordinator to s.
 func (i *Instance) UpdateState(s State) (ins *Instance, err error) {
-	newrev, err := i.Set("state", string(s))
+	p := i.Path.Prefix("state")
+
+	for {
+		var (
+			state   []byte
+			filerev int64
+			s1      Snapshot
+		)
+
+		state, filerev, err = i.conn.Get(p, nil)
+		if err != nil {
+			return
+		}
+		if !CanTransition(State(state), s) {
+			return nil, &StateError{From: string(state), To: string(s), Path: p}
+		}
+
+		// Check the transition again if the state changed in the meantime.
+		s1, err = i.Snapshot.CompareAndSet(p, filerev, string(s))
+		if err == nil {
+			return i.updated(s1.Rev, s), nil
+		}
+		if !IsErrRevMismatch(err) {
+			return
+		}
+	}
+}
+
+// ForceState sets the instance's state regardless of its current state,
+// for operators to fix up instances. s must still be a known state.
+func (i *Instance) ForceState(s State) (ins *Instance, err error) {
+	if _, ok := insTransitions[s]; !ok {
+		return nil, &StateError{From: string(i.State), To: string(s), Path: i.Path.Prefix("state")}
+	}
+	newrev, err := i.conn.Set(i.Path.Prefix("state"), -1, []byte(s))
 	if err != nil {
 		return
 	}
-	ins = i.FastForward(newrev)
+	return i.updated(newrev, s), nil
+}
+
+func (i *Instance) updated(rev int64, s State) (ins *Instance) {
+	ins = i.FastForward(rev)
 	ins.State = s
 
 	return
 }
 
+// CanTransition reports whether an instance may change from state from to state to.
+func CanTransition(from State, to State) bool {
+	for _, s := range insTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateInfo stores the instance's pid, hostname, start time,
+// exit status and labels in the coordinator.
+func (i *Instance) UpdateInfo() (ins *Instance, err error) {
+	info, err := json.Marshal(i.Info())
+	if err != nil {
+		return
+	}
+	newrev, err := i.Set("info", string(info))
+	if err != nil {
+		return
+	}
+	ins = i.FastForward(newrev)
+
+	return
+}
+
+// Info returns the document stored as the instance's info.
+func (i *Instance) Info() InstanceInfo {
+	info := InstanceInfo{
+		Version:    INSTANCE_INFO_VERSION,
+		App:        i.AppName,
+		Revision:   i.RevisionName,
+		Proc:       string(i.ProcessName),
+		Host:       i.Host,
+		Port:       i.Port,
+		Pid:        i.Pid,
+		Hostname:   i.Hostname,
+		ExitStatus: i.ExitStatus,
+		Labels:     i.Labels,
+	}
+	if !i.StartTime.IsZero() {
+		info.StartTime = &i.StartTime
+	}
+	return info
+}
+
+// parseInstanceInfo reads both the JSON and the legacy info format.
+func parseInstanceInfo(data []byte) (info InstanceInfo, err error) {
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		err = json.Unmarshal(data, &info)
+		return
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 5 {
+		return info, NewError(ErrInvalidState, fmt.Sprintf("malformed instance info '%s'", data))
+	}
+	port, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return info, NewError(ErrInvalidState, fmt.Sprintf("malformed port in instance info '%s'", data))
+	}
+
+	return InstanceInfo{App: fields[0], Revision: fields[1], Proc: fields[2], Host: fields[3], Port: port}, nil
+}
+
+// migrateInstanceInfo rewrites legacy instance info as JSON.
+func migrateInstanceInfo(s Snapshot, txn *Txn) error {
+	ids, err := s.Getdir(INSTANCES_PATH)
+	if IsErrNoEnt(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		p := path.Join(INSTANCES_PATH, id, "info")
+
+		data, _, err := s.GetBytes(p)
+		if IsErrNoEnt(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		info, err := parseInstanceInfo(data)
+		if err != nil {
+			return err
+		}
+		if info.Version >= INSTANCE_INFO_VERSION {
+			continue
+		}
+
+		info.Version = INSTANCE_INFO_VERSION
+		data, err = json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		txn.SetBytes(p, data)
+	}
+	return nil
+}
+
+// Heartbeat records that the instance is alive. Instances which stop
+// sending heartbeats are marked dead by ReapInstances.
+func (i *Instance) Heartbeat() (ins *Instance, err error) {
+	newrev, err := i.conn.Set(i.Path.Prefix("heartbeat"), -1, []byte(time.Now().UTC().String()))
+	if err != nil {
+		return
+	}
+	ins = i.FastForward(newrev)
+
+	return
+}
+
+// LastHeartbeat returns the time of the instance's last heartbeat. It
+// fails with ErrNoEnt if the instance never sent one.
+func (i *Instance) LastHeartbeat() (t time.Time, err error) {
+	value, _, err := i.Get("heartbeat")
+	if err != nil {
+		return
+	}
+	return time.Parse(timeLayout, value)
+}
+
+// ReapInstances marks instances whose last heartbeat is older than ttl as
+// dead, which emits EvInsDead. Only initial and started instances are
+// reaped, instances which never sent a heartbeat are left alone. It
+// returns the reaped instances.
+func ReapInstances(s Snapshot, ttl time.Duration) (reaped []*Instance, err error) {
+	s = s.FastForward(-1)
+	reaped = []*Instance{}
+
+	ids, err := s.Getdir(INSTANCES_PATH)
+	if IsErrNoEnt(err) {
+		return reaped, nil
+	}
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		var (
+			ins  *Instance
+			last time.Time
+		)
+
+		ins, err = GetInstance(s, id)
+		if IsErrNoEnt(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if ins.State != InsStateInitial && ins.State != InsStateStarted {
+			continue
+		}
+
+		last, err = ins.LastHeartbeat()
+		if IsErrNoEnt(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if time.Since(last) <= ttl {
+			continue
+		}
+
+		// Leave instances alone which can't be marked dead anymore.
+		ins, err = ins.UpdateState(InsStateDead)
+		if errors.Is(err, ErrInvalidState) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		reaped = append(reaped, ins)
+	}
+	return reaped, nil
+}
+
+// Id returns the name of the instance in the registry, made of its
+// host and port. The dots of IPv4 and colons of IPv6 addresses are
+// replaced with dashes, e.g. "10-0-0-1-8080" or "2001-db8--1-8080".
 func (i *Instance) Id() string {
-	return fmt.Sprintf("%s-%d", strings.Replace(i.Host, ".", "-", -1), i.Port)
+	return fmt.Sprintf("%s-%d", strings.NewReplacer(".", "-", ":", "-").Replace(i.Host), i.Port)
 }
 
 func (i *Instance) String() string {
@@ -139,7 +402,7 @@ func (i *Instance) String() string {
 }
 
 func (i *Instance) AddrString() string {
-	return i.Host + ":" + strconv.Itoa(i.Port)
+	return net.JoinHostPort(i.Host, strconv.Itoa(i.Port))
 }
 
 func (i *Instance) RefString() string {
@@ -150,28 +413,99 @@ func (i *Instance) LogString() string {
 	return fmt.Sprintf("%s (%s)", i.RefString(), i.AddrString())
 }
 
+// InstanceFilter selects instances by their fields. Fields with
+// zero values match any instance.
+type InstanceFilter struct {
+	App      string
+	Revision string
+	ProcType ProcessName
+	State    State
+	Host     string // Matches the address or the hostname
+	Port     int
+}
+
+// Match reports whether the instance is selected by the filter.
+func (f InstanceFilter) Match(i *Instance) bool {
+	switch {
+	case f.App != "" && f.App != i.AppName:
+	case f.Revision != "" && f.Revision != i.RevisionName:
+	case f.ProcType != "" && f.ProcType != i.ProcessName:
+	case f.State != "" && f.State != i.State:
+	case f.Host != "" && f.Host != i.Host && f.Host != i.Hostname:
+	case f.Port != 0 && f.Port != i.Port:
+	default:
+		return true
+	}
+	return false
+}
+
+// Instances returns the instances of all apps selected by the filter.
+func Instances(s Snapshot, filter InstanceFilter) (instances []*Instance, err error) {
+	instances = []*Instance{}
+
+	ids, err := s.Getdir(INSTANCES_PATH)
+	if IsErrNoEnt(err) {
+		return instances, nil
+	}
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		var ins *Instance
+
+		ins, err = getInstance(s, id, &s.Rev)
+		if IsErrNoEnt(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if filter.Match(ins) {
+			instances = append(instances, ins)
+		}
+	}
+	return instances, nil
+}
+
 // GetInstance returns an Instance from the given app, rev, proc and instance ids.
 func GetInstance(s Snapshot, insName string) (ins *Instance, err error) {
+	return getInstance(s, insName, nil)
+}
+
+// getInstance is GetInstance reading the instance at rev, or at the
+// latest revision if rev is nil.
+func getInstance(s Snapshot, insName string, rev *int64) (ins *Instance, err error) {
 	p := path.Join(INSTANCES_PATH, insName)
 
-	state, _, err := s.conn.Get(p+"/state", nil)
+	state, _, err := s.conn.Get(p+"/state", rev)
 	if err != nil {
 		return
 	}
 
-	info, _, err := s.conn.Get(p+"/info", nil)
+	data, _, err := s.conn.Get(p+"/info", rev)
 	if err != nil {
 		return
 	}
-	fields := strings.Fields(string(info))
+	info, err := parseInstanceInfo(data)
+	if err != nil {
+		return nil, opError("get", p+"/info", 0, err)
+	}
 
-	addr := fields[3] + ":" + fields[4]
+	addr := net.JoinHostPort(info.Host, strconv.Itoa(info.Port))
 
-	ins, err = NewInstance(fields[2], fields[1], fields[0], addr, s)
+	ins, err = NewInstance(info.Proc, info.Revision, info.App, addr, s)
 	if err != nil {
 		return
 	}
 	ins.State = State(state)
+	ins.Pid = info.Pid
+	ins.Hostname = info.Hostname
+	ins.ExitStatus = info.ExitStatus
+	ins.Labels = info.Labels
+	if info.StartTime != nil {
+		ins.StartTime = *info.StartTime
+	}
 
 	return
 }
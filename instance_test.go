@@ -6,11 +6,13 @@
 package visor
 
 import (
+	"errors"
 	"testing"
+	"time"
 )
 
 func instanceSetup(addr string, pType ProcessName) (ins *Instance) {
-	s, err := Dial(DEFAULT_ADDR, "/instance-test")
+	s, err := testDial("/instance-test")
 	if err != nil {
 		panic(err)
 	}
@@ -162,3 +164,360 @@ func TestInstanceUpdateState(t *testing.T) {
 		t.Error("Instance state wasn't persisted in the coordinator")
 	}
 }
+
+func TestGetInstanceLegacyInfo(t *testing.T) {
+	ins := instanceSetup("127.0.0.1:9595", "web")
+
+	s, err := ins.Snapshot.Set(ins.Path.Prefix("info"), "ins-test 7abcde6 web 127.0.0.1 9595")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = s.Set(ins.Path.Prefix("state"), string(InsStateStarted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := GetInstance(s, ins.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.AppName != "ins-test" || i.RevisionName != "7abcde6" || i.ProcessName != "web" || i.AddrString() != "127.0.0.1:9595" {
+		t.Errorf("unexpected instance %#v", i)
+	}
+}
+
+func TestGetInstanceMalformedInfo(t *testing.T) {
+	ins := instanceSetup("127.0.0.1:9696", "web")
+
+	s, err := ins.Snapshot.Set(ins.Path.Prefix("info"), "ins-test 7abcde6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = s.Set(ins.Path.Prefix("state"), string(InsStateStarted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = GetInstance(s, ins.Id()); err == nil {
+		t.Error("expected malformed info to fail")
+	}
+}
+
+func TestInstanceUpdateInfo(t *testing.T) {
+	ins := instanceSetup("127.0.0.1:9797", "web")
+
+	ins, err := ins.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := 3
+	ins.Pid = 1234
+	ins.Hostname = "box-1"
+	ins.StartTime = time.Date(2012, 7, 1, 12, 0, 0, 0, time.UTC)
+	ins.ExitStatus = &status
+	ins.Labels = map[string]string{"zone": "a"}
+
+	ins, err = ins.UpdateInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := GetInstance(ins.Snapshot, ins.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Pid != 1234 || i.Hostname != "box-1" || !i.StartTime.Equal(ins.StartTime) || i.Labels["zone"] != "a" {
+		t.Errorf("unexpected instance %#v", i)
+	}
+	if i.ExitStatus == nil || *i.ExitStatus != 3 {
+		t.Errorf("expected exit status 3, got %v", i.ExitStatus)
+	}
+}
+
+func TestInstanceIPv6(t *testing.T) {
+	ins := instanceSetup("[2001:db8::1]:9898", "web")
+
+	if ins.Host != "2001:db8::1" || ins.Port != 9898 {
+		t.Errorf("unexpected host and port %s %d", ins.Host, ins.Port)
+	}
+	if ins.Id() != "2001-db8--1-9898" {
+		t.Errorf("expected id 2001-db8--1-9898, got %s", ins.Id())
+	}
+	if ins.AddrString() != "[2001:db8::1]:9898" {
+		t.Errorf("expected addr [2001:db8::1]:9898, got %s", ins.AddrString())
+	}
+
+	ins, err := ins.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := GetInstance(ins.Snapshot, ins.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Host != ins.Host || i.Port != ins.Port || i.Id() != ins.Id() {
+		t.Errorf("expected %s, got %s", ins.AddrString(), i.AddrString())
+	}
+}
+
+func TestGetInstanceLegacyInfoIPv6(t *testing.T) {
+	ins := instanceSetup("[::1]:9999", "web")
+
+	s, err := ins.Snapshot.Set(ins.Path.Prefix("info"), "ins-test 7abcde6 web ::1 9999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = s.Set(ins.Path.Prefix("state"), string(InsStateStarted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := GetInstance(s, ins.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.AddrString() != "[::1]:9999" {
+		t.Errorf("expected addr [::1]:9999, got %s", i.AddrString())
+	}
+}
+
+func TestInstanceHeartbeat(t *testing.T) {
+	ins := instanceSetup("127.0.0.1:9191", "web")
+
+	ins, err := ins.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ins.LastHeartbeat(); !IsErrNoEnt(err) {
+		t.Errorf("expected ErrNoEnt, got %v", err)
+	}
+
+	ins, err = ins.Heartbeat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := ins.LastHeartbeat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(last) > time.Minute {
+		t.Errorf("expected recent heartbeat, got %s", last)
+	}
+}
+
+func TestReapInstances(t *testing.T) {
+	ins := instanceSetup("127.0.0.1:9292", "web")
+	old := time.Now().Add(-time.Hour).UTC().String()
+
+	// Silent for an hour.
+	silent, err := ins.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = silent.Set("heartbeat", old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alive.
+	alive, err := NewInstance("web", "7abcde6", "ins-test", "127.0.0.1:9293", silent.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alive, err = alive.FastForward(-1).Register(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = alive.Heartbeat(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Never sent a heartbeat.
+	quiet, err := NewInstance("web", "7abcde6", "ins-test", "127.0.0.1:9294", alive.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = quiet.FastForward(-1).Register(); err != nil {
+		t.Fatal(err)
+	}
+
+	reaped, err := ReapInstances(ins.Snapshot, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reaped) != 1 || reaped[0].Id() != silent.Id() {
+		t.Fatalf("expected %s to be reaped, got %v", silent.Id(), reaped)
+	}
+
+	s := reaped[0].Snapshot
+	for id, state := range map[string]State{silent.Id(): InsStateDead, alive.Id(): InsStateInitial, quiet.Id(): InsStateInitial} {
+		i, err := GetInstance(s, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i.State != state {
+			t.Errorf("expected %s to be %s, got %s", id, state, i.State)
+		}
+	}
+
+	if reaped, _ = ReapInstances(s, time.Minute); len(reaped) != 0 {
+		t.Errorf("expected dead instances not to be reaped again, got %v", reaped)
+	}
+}
+
+func TestInstanceUpdateStateInvalid(t *testing.T) {
+	ins := instanceSetup("127.0.0.1:9393", "web")
+
+	ins, err := ins.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, err = ins.UpdateState(InsStateDead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, state := range []State{InsStateInitial, InsStateStarted, "strated"} {
+		_, err = ins.UpdateState(state)
+		if !errors.Is(err, ErrInvalidState) {
+			t.Errorf("expected ErrInvalidState, got %v", err)
+		}
+
+		var e *StateError
+		if !errors.As(err, &e) || e.From != string(InsStateDead) || e.To != string(state) {
+			t.Errorf("expected *StateError from dead to %s, got %#v", state, err)
+		}
+	}
+}
+
+func TestInstanceUpdateStateCurrent(t *testing.T) {
+	ins := instanceSetup("127.0.0.1:9494", "web")
+
+	ins, err := ins.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changed behind the instance's back, exited can't change to started.
+	if _, err = ins.Snapshot.Set(ins.Path.Prefix("state"), string(InsStateExited)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ins.UpdateState(InsStateStarted); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState, got %v", err)
+	}
+	if _, err = ins.UpdateState(InsStateDead); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInstanceForceState(t *testing.T) {
+	ins := instanceSetup("127.0.0.1:9595", "web")
+
+	ins, err := ins.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, err = ins.UpdateState(InsStateDead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ins, err = ins.ForceState(InsStateStarted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, _ := GetInstance(ins.Snapshot, ins.Id()); i.State != InsStateStarted {
+		t.Errorf("expected state %s, got %s", InsStateStarted, i.State)
+	}
+
+	if _, err = ins.ForceState("strated"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState, got %v", err)
+	}
+}
+
+func TestInstances(t *testing.T) {
+	ins := instanceSetup("127.0.0.1:9696", "web")
+	s := ins.Snapshot
+
+	for _, addr := range []string{"127.0.0.1:9696", "127.0.0.1:9697", "10.0.0.1:9696"} {
+		i, err := NewInstance("web", "7abcde6", "ins-test", addr, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i, err = i.Register(); err != nil {
+			t.Fatal(err)
+		}
+		s = i.Snapshot
+	}
+	i, err := GetInstance(s, "10-0-0-1-9696")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, err = i.UpdateState(InsStateFailed); err != nil {
+		t.Fatal(err)
+	}
+	s = i.Snapshot
+
+	for filter, n := range map[InstanceFilter]int{
+		InstanceFilter{}: 3,
+		InstanceFilter{App: "ins-test", ProcType: "web"}:            3,
+		InstanceFilter{App: "other"}:                                0,
+		InstanceFilter{Host: "127.0.0.1"}:                           2,
+		InstanceFilter{Port: 9696}:                                  2,
+		InstanceFilter{Host: "127.0.0.1", Port: 9697}:               1,
+		InstanceFilter{State: InsStateFailed}:                       1,
+		InstanceFilter{Revision: "7abcde6", State: InsStateStarted}: 0,
+	} {
+		instances, err := Instances(s, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(instances) != n {
+			t.Errorf("expected %d instances for %#v, got %d", n, filter, len(instances))
+		}
+	}
+}
+
+func TestInstancesOlderSnapshot(t *testing.T) {
+	ins, err := instanceSetup("127.0.0.1:9696", "web").Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewInstance("web", "7abcde6", "ins-test", "127.0.0.1:9697", ins.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, err = other.Register(); err != nil {
+		t.Fatal(err)
+	}
+	old := other.Snapshot
+
+	failed, err := ins.FastForward(-1).UpdateState(InsStateFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = other.FastForward(-1).Unregister(); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := Instances(old, InstanceFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("expected 2 instances at the old snapshot, got %d", len(instances))
+	}
+	for _, i := range instances {
+		if i.State == InsStateFailed {
+			t.Errorf("expected state of %s at the old snapshot, got %s", i.Id(), i.State)
+		}
+	}
+
+	instances, err = Instances(failed.Snapshot.FastForward(-1), InstanceFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].State != InsStateFailed {
+		t.Errorf("expected one failed instance at the latest snapshot, got %v", instances)
+	}
+}
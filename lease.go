@@ -0,0 +1,172 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DEFAULT_TICKET_LEASE is the lease of claims made with (*Ticket).Claim.
+const DEFAULT_TICKET_LEASE = time.Minute
+
+// Renew extends the lease of the host's claim to the given duration
+// from now. It fails with ErrUnauthorized if the host doesn't hold the
+// claim, and with ErrRevMismatch if the ticket changed concurrently,
+// for example because SweepTickets unclaimed it.
+func (t *Ticket) Renew(host string, lease time.Duration) (t1 *Ticket, err error) {
+	s := t.Snapshot.FastForward(-1)
+
+	exists, _, err := s.Exists(t.claimPath(host))
+	if err != nil {
+		return t, err
+	}
+	if !exists {
+		return t, ErrUnauthorized
+	}
+	status, _, err := s.Get(t.Path.Prefix("status"))
+	if err != nil {
+		return t, err
+	}
+	if TicketStatus(status) != TicketStatusClaimed {
+		return t, NewError(ErrInvalidState, fmt.Sprintf("can't renew ticket, status is '%s'", status))
+	}
+
+	deadline := time.Now().Add(lease).UTC()
+
+	// Writing the status again makes the renewal fail if the
+	// ticket was unclaimed after it was read.
+	txn := s.Txn()
+	txn.Set(t.Path.Prefix("status"), string(TicketStatusClaimed))
+	txn.Set(t.Path.Prefix("lease"), deadline.String())
+
+	s, err = txn.Commit()
+	if err != nil {
+		return t, err
+	}
+	t.Lease = deadline
+	t1 = t.FastForward(s.Rev)
+
+	return
+}
+
+// Expired reports whether the ticket is claimed and its lease
+// expired. Claims without a lease never expire.
+func (t *Ticket) Expired() bool {
+	return t.Status == TicketStatusClaimed && !t.Lease.IsZero() && time.Now().After(t.Lease)
+}
+
+// Due reports whether the ticket waits for a retry whose backoff passed.
+func (t *Ticket) Due() bool {
+	return t.Status == TicketStatusRetry && !time.Now().Before(t.RetryAt)
+}
+
+// SweepTickets unclaims the claimed tickets whose lease expired, as
+// well as the tickets due for a retry, and increases their requeue
+// count. Expired leases are recorded as failed attempts. Unclaiming
+// makes the tickets show up in WatchTicket again. Tickets which are
+// renewed or changed while being swept are left alone. It returns
+// the requeued tickets.
+func SweepTickets(s Snapshot) (requeued []*Ticket, err error) {
+	s = s.FastForward(-1)
+	requeued = []*Ticket{}
+
+	ids, err := fsckGetdir(s, TICKETS_PATH)
+	if err != nil {
+		return
+	}
+
+	for _, idStr := range ids {
+		var t *Ticket
+
+		id, e := strconv.ParseInt(idStr, 10, 64)
+		if e != nil {
+			continue
+		}
+		t, err = GetTicket(s, id)
+		if IsErrNoEnt(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		switch {
+		case t.Expired():
+			t, err = t.requeue(s, "lease expired")
+		case t.Due():
+			t, err = t.requeue(s, "")
+		default:
+			continue
+		}
+		if errors.Is(err, ErrRevMismatch) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		requeued = append(requeued, t)
+	}
+	return requeued, nil
+}
+
+// requeue unclaims the ticket at the snapshot's revision, dropping
+// all claims, and increases its requeue count. If reason is set, the
+// latest attempt is recorded as failed for it.
+func (t *Ticket) requeue(s Snapshot, reason string) (t1 *Ticket, err error) {
+	hosts, err := fsckGetdir(s, t.Path.Prefix("claims"))
+	if err != nil {
+		return
+	}
+
+	txn := s.Txn()
+	for _, host := range hosts {
+		txn.Del(t.claimPath(host))
+	}
+	if err = t.delLease(s, txn); err != nil {
+		return
+	}
+	if !t.RetryAt.IsZero() {
+		txn.Del(t.Path.Prefix("retry-at"))
+	}
+	if reason != "" {
+		if err = t.failAttempt(txn, reason); err != nil {
+			return
+		}
+	}
+	txn.Set(t.Path.Prefix("requeues"), strconv.Itoa(t.Requeues+1))
+	tr, err := t.transition(s, txn, TicketStatusUnClaimed, "", time.Now().UTC())
+	if err != nil {
+		return
+	}
+
+	s, err = txn.Commit()
+	if err != nil {
+		return
+	}
+	t.Status = TicketStatusUnClaimed
+	t.Lease = time.Time{}
+	t.RetryAt = time.Time{}
+	t.Requeues++
+	t.Timeline = append(t.Timeline, tr)
+	t1 = t.FastForward(s.Rev)
+
+	return
+}
+
+// delLease adds the deletion of the lease to txn, if the
+// ticket has one at the snapshot's revision.
+func (t *Ticket) delLease(s Snapshot, txn *Txn) error {
+	exists, _, err := s.Exists(t.Path.Prefix("lease"))
+	if err != nil {
+		return err
+	}
+	if exists {
+		txn.Del(t.Path.Prefix("lease"))
+	}
+	return nil
+}
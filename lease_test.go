@@ -0,0 +1,162 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func leaseSetup() (s Snapshot) {
+	s, err := testDial("/lease-test")
+	if err != nil {
+		panic(err)
+	}
+	s.conn.Del("/", s.Rev)
+
+	return s.FastForward(-1)
+}
+
+func TestTicketClaimLease(t *testing.T) {
+	s := leaseSetup()
+
+	ticket, err := CreateTicket("lease", "abc", "web", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err = ticket.ClaimLease("host-a", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ticket, err = GetTicket(ticket.Snapshot, ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := ticket.Lease.Sub(time.Now()); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expected lease in an hour, got %s", ticket.Lease)
+	}
+	if ticket.Expired() {
+		t.Error("expected lease not to be expired")
+	}
+}
+
+func TestTicketRenew(t *testing.T) {
+	s := leaseSetup()
+
+	ticket, err := CreateTicket("lease", "abc", "web", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err = ticket.ClaimLease("host-a", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ticket.Renew("host-b", time.Hour); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+
+	ticket, err = ticket.Renew("host-a", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requeued, err := SweepTickets(ticket.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requeued) != 0 {
+		t.Errorf("expected renewed ticket not to be requeued, got %v", requeued)
+	}
+}
+
+func TestSweepTickets(t *testing.T) {
+	s := leaseSetup()
+	l := make(chan *Ticket)
+
+	expired, err := CreateTicket("lease", "abc", "web", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired, err = expired.ClaimLease("host-a", -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	leased, err := CreateTicket("lease", "abc", "worker", OpStart, expired.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leased, err = leased.ClaimLease("host-b", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	go WatchTicket(leased.Snapshot, l, make(chan error))
+
+	requeued, err := SweepTickets(leased.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requeued) != 1 || requeued[0].Id != expired.Id {
+		t.Fatalf("expected ticket %d to be requeued, got %v", expired.Id, requeued)
+	}
+	expectTicket("lease", "abc", "web", OpStart, l, t)
+
+	ticket, err := GetTicket(requeued[0].Snapshot, expired.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Status != TicketStatusUnClaimed {
+		t.Errorf("expected status unclaimed, got %s", ticket.Status)
+	}
+	if ticket.Requeues != 1 {
+		t.Errorf("expected 1 requeue, got %d", ticket.Requeues)
+	}
+	if claims, _ := ticket.Claims(); len(claims) != 0 {
+		t.Errorf("expected no claims, got %v", claims)
+	}
+
+	// The expired claimer lost the ticket.
+	if _, err = expired.Renew("host-a", time.Hour); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+	if ticket, err = ticket.ClaimLease("host-c", -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if requeued, err = SweepTickets(ticket.Snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if len(requeued) != 1 || requeued[0].Requeues != 2 {
+		t.Errorf("expected ticket to be requeued twice, got %v", requeued)
+	}
+}
+
+func TestRenewAfterSweep(t *testing.T) {
+	s := leaseSetup()
+
+	ticket, err := CreateTicket("lease", "abc", "web", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket, err = ticket.ClaimLease("host-a", -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sweep wins over a renewal which read the ticket before it.
+	stale := ticket.Snapshot
+	swept, err := GetTicket(stale, ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = swept.requeue(stale, "lease expired"); err != nil {
+		t.Fatal(err)
+	}
+
+	txn := stale.Txn()
+	txn.Set(ticket.Path.Prefix("status"), string(TicketStatusClaimed))
+	txn.Set(ticket.Path.Prefix("lease"), time.Now().UTC().String())
+	if _, err = txn.Commit(); !errors.Is(err, ErrRevMismatch) {
+		t.Errorf("expected ErrRevMismatch, got %v", err)
+	}
+}
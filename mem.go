@@ -0,0 +1,508 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Revisions reported by (Backend).Stat for special files,
+// as defined by doozerd.
+const (
+	revMissing int64 = 0
+	revDir     int64 = -2
+)
+
+func init() {
+	RegisterBackend("mem", dialMem)
+}
+
+var (
+	memStoresMu sync.Mutex
+	memStores   = map[string]*memStore{}
+)
+
+// dialMem opens an in-process Backend. URIs of the form "mem:<name>"
+// share the store registered under <name> for the lifetime of the
+// process, a plain "mem:" always returns a new, empty store.
+func dialMem(uri string) (Backend, error) {
+	name := strings.TrimPrefix(uri, "mem:")
+
+	if name == "" {
+		return newMemBackend(newMemStore()), nil
+	}
+
+	memStoresMu.Lock()
+	defer memStoresMu.Unlock()
+
+	st, ok := memStores[name]
+	if !ok {
+		st = newMemStore()
+		memStores[name] = st
+	}
+	return newMemBackend(st), nil
+}
+
+// memVersion is the value of a file from a given revision on.
+type memVersion struct {
+	rev   int64
+	value []byte
+	del   bool
+}
+
+// memStore keeps the full history of every file, so it can
+// answer reads and waits at any past revision.
+type memStore struct {
+	mu      sync.Mutex
+	rev     int64
+	files   map[string][]memVersion
+	log     []Change // log[i].Rev == i+1
+	changed chan struct{}
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		files:   map[string][]memVersion{},
+		changed: make(chan struct{}),
+	}
+}
+
+// memBackend implements Backend on top of a memStore.
+type memBackend struct {
+	store  *memStore
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newMemBackend(st *memStore) *memBackend {
+	return &memBackend{store: st, closed: make(chan struct{})}
+}
+
+func (b *memBackend) isClosed() bool {
+	select {
+	case <-b.closed:
+		return true
+	default:
+	}
+	return false
+}
+
+func (b *memBackend) Get(p string, rev *int64) (value []byte, filerev int64, err error) {
+	if b.isClosed() {
+		return nil, 0, ErrClosed
+	}
+	p, err = cleanMemPath(p)
+	if err != nil {
+		return
+	}
+
+	st := b.store
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	at := st.at(rev)
+
+	if v, ok := st.file(p, at); ok {
+		return append([]byte{}, v.value...), v.rev, nil
+	}
+	if st.isDir(p, at) {
+		return nil, revDir, &Error{Err: ErrIsDir, Path: p}
+	}
+	return nil, revMissing, nil
+}
+
+func (b *memBackend) Set(p string, rev int64, value []byte) (newrev int64, err error) {
+	if b.isClosed() {
+		return 0, ErrClosed
+	}
+	p, err = cleanMemPath(p)
+	if err != nil {
+		return
+	}
+
+	st := b.store
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	newrev, err = st.set(p, rev, value)
+	if err != nil {
+		return 0, err
+	}
+	st.notify()
+
+	return
+}
+
+func (b *memBackend) Del(p string, rev int64) (err error) {
+	if b.isClosed() {
+		return ErrClosed
+	}
+	p, err = cleanMemPath(p)
+	if err != nil {
+		return
+	}
+
+	st := b.store
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	_, err = st.del(p, rev)
+	if err != nil {
+		return
+	}
+	st.notify()
+
+	return nil
+}
+
+// Batch applies all mutations or none of them. Each mutation gets
+// its own revision, but readers and waiters only observe the batch
+// once it was applied completely.
+func (b *memBackend) Batch(muts []Mutation) (newrev int64, err error) {
+	if b.isClosed() {
+		return 0, ErrClosed
+	}
+
+	st := b.store
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	rev := st.rev
+
+	for _, m := range muts {
+		var p string
+
+		p, err = cleanMemPath(m.Path)
+		if err == nil {
+			if m.Del {
+				newrev, err = st.del(p, m.Rev)
+			} else {
+				newrev, err = st.set(p, m.Rev, m.Value)
+			}
+		}
+		if err != nil {
+			st.truncate(rev)
+			return 0, err
+		}
+	}
+	if newrev > rev {
+		st.notify()
+	}
+
+	return newrev, nil
+}
+
+func (b *memBackend) Stat(p string, rev *int64) (length int, filerev int64, err error) {
+	if b.isClosed() {
+		return 0, 0, ErrClosed
+	}
+	p, err = cleanMemPath(p)
+	if err != nil {
+		return
+	}
+
+	st := b.store
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	at := st.at(rev)
+
+	if v, ok := st.file(p, at); ok {
+		return len(v.value), v.rev, nil
+	}
+	if st.isDir(p, at) {
+		return st.dirLen(p, at), revDir, nil
+	}
+	return 0, revMissing, nil
+}
+
+func (b *memBackend) Getdir(p string, rev int64, offset, limit int) (names []string, err error) {
+	if b.isClosed() {
+		return nil, ErrClosed
+	}
+	p, err = cleanMemPath(p)
+	if err != nil {
+		return
+	}
+
+	st := b.store
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, ok := st.file(p, rev); ok {
+		return nil, &Error{Err: ErrNotDir, Path: p}
+	}
+	if !st.isDir(p, rev) {
+		return nil, NewError(ErrNoEnt, fmt.Sprintf(`dir "%s" not found at %d`, p, rev))
+	}
+
+	names = st.entries(p, rev)
+
+	if offset > len(names) {
+		offset = len(names)
+	}
+	names = names[offset:]
+	if limit >= 0 && limit < len(names) {
+		names = names[:limit]
+	}
+	return names, nil
+}
+
+func (b *memBackend) Wait(glob string, rev int64) (Change, error) {
+	return b.WaitContext(context.Background(), glob, rev)
+}
+
+func (b *memBackend) WaitContext(ctx context.Context, glob string, rev int64) (Change, error) {
+	if b.isClosed() {
+		return Change{}, ErrClosed
+	}
+	re, err := compileGlob(glob)
+	if err != nil {
+		return Change{}, err
+	}
+	if rev < 1 {
+		rev = 1
+	}
+
+	st := b.store
+
+	for {
+		st.mu.Lock()
+		for ; rev <= st.rev; rev++ {
+			c := st.log[rev-1]
+			if re.MatchString(c.Path) {
+				st.mu.Unlock()
+				c.Body = append([]byte{}, c.Body...)
+				return c, nil
+			}
+		}
+		changed := st.changed
+		st.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-b.closed:
+			return Change{}, ErrClosed
+		case <-ctx.Done():
+			return Change{}, ctx.Err()
+		}
+	}
+}
+
+// memWaiter needs nothing besides ctx to abort its waits.
+type memWaiter struct {
+	b   *memBackend
+	ctx context.Context
+}
+
+func (b *memBackend) Waiter(ctx context.Context) (Waiter, error) {
+	return memWaiter{b, ctx}, nil
+}
+
+func (w memWaiter) Wait(glob string, rev int64) (Change, error) {
+	return w.b.WaitContext(w.ctx, glob, rev)
+}
+
+func (w memWaiter) Close() {}
+
+func (b *memBackend) Rev() (int64, error) {
+	if b.isClosed() {
+		return 0, ErrClosed
+	}
+
+	b.store.mu.Lock()
+	defer b.store.mu.Unlock()
+
+	return b.store.rev, nil
+}
+
+// Close closes this handle, the underlying store is kept
+// for other handles dialed with the same name.
+func (b *memBackend) Close() {
+	b.once.Do(func() { close(b.closed) })
+}
+
+// at returns the revision to read at, given an optional revision.
+func (st *memStore) at(rev *int64) int64 {
+	if rev == nil || *rev > st.rev {
+		return st.rev
+	}
+	return *rev
+}
+
+// set validates and records a write of p. Waiters aren't notified.
+func (st *memStore) set(p string, rev int64, value []byte) (int64, error) {
+	if st.isDir(p, st.rev) {
+		return 0, &Error{Err: ErrIsDir, Path: p}
+	}
+	for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+		if _, ok := st.file(dir, st.rev); ok {
+			return 0, &Error{Err: ErrNotDir, Path: dir}
+		}
+	}
+
+	if v, ok := st.file(p, st.rev); ok && rev != -1 && rev < v.rev {
+		return 0, memRevMismatch(p, rev, v.rev)
+	}
+
+	return st.apply(p, append([]byte{}, value...), false), nil
+}
+
+// del validates and records the deletion of p. Waiters aren't notified.
+func (st *memStore) del(p string, rev int64) (int64, error) {
+	v, ok := st.file(p, st.rev)
+	if !ok {
+		if st.isDir(p, st.rev) {
+			return 0, &Error{Err: ErrIsDir, Path: p}
+		}
+		return 0, NewError(ErrNoEnt, fmt.Sprintf(`path "%s" not found`, p))
+	}
+	if rev != -1 && rev < v.rev {
+		return 0, memRevMismatch(p, rev, v.rev)
+	}
+
+	return st.apply(p, nil, true), nil
+}
+
+// apply records a mutation of p.
+func (st *memStore) apply(p string, value []byte, del bool) int64 {
+	st.rev++
+	st.files[p] = append(st.files[p], memVersion{st.rev, value, del})
+
+	flag := ChangeSet
+	if del {
+		flag = ChangeDel
+	}
+	st.log = append(st.log, Change{Rev: st.rev, Path: p, Body: value, Flag: flag})
+
+	return st.rev
+}
+
+// truncate discards all mutations recorded after rev.
+func (st *memStore) truncate(rev int64) {
+	for _, c := range st.log[rev:] {
+		versions := st.files[c.Path]
+		st.files[c.Path] = versions[:len(versions)-1]
+		if len(st.files[c.Path]) == 0 {
+			delete(st.files, c.Path)
+		}
+	}
+	st.log = st.log[:rev]
+	st.rev = rev
+}
+
+// notify wakes up all waiters.
+func (st *memStore) notify() {
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
+
+// file returns the version of the file at p which was current at rev.
+func (st *memStore) file(p string, rev int64) (v memVersion, ok bool) {
+	versions := st.files[p]
+
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].rev > rev })
+	if i == 0 {
+		return
+	}
+	v = versions[i-1]
+	return v, !v.del
+}
+
+// isDir returns true if any file below p existed at rev.
+func (st *memStore) isDir(p string, rev int64) bool {
+	if p == "/" {
+		return true
+	}
+	prefix := p + "/"
+
+	for name := range st.files {
+		if strings.HasPrefix(name, prefix) {
+			if _, ok := st.file(name, rev); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// entries returns the sorted names of the direct children of p at rev.
+func (st *memStore) entries(p string, rev int64) []string {
+	prefix := p + "/"
+	if p == "/" {
+		prefix = p
+	}
+	seen := map[string]bool{}
+
+	for name := range st.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, ok := st.file(name, rev); !ok {
+			continue
+		}
+		seen[strings.SplitN(name[len(prefix):], "/", 2)[0]] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (st *memStore) dirLen(p string, rev int64) int {
+	return len(st.entries(p, rev))
+}
+
+func memRevMismatch(p string, rev, filerev int64) error {
+	return &Error{
+		Err:     ErrRevMismatch,
+		Message: fmt.Sprintf(`path "%s" is at %d, not at or below %d`, p, filerev, rev),
+		Path:    p,
+		FileRev: filerev,
+	}
+}
+
+func cleanMemPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", &Error{Err: ErrBadPath, Path: p}
+	}
+	return path.Clean(p), nil
+}
+
+// compileGlob translates a doozer glob into a regular expression:
+// "**" matches any sequence of characters, "*" matches any sequence
+// of characters except "/" and "?" matches a single character.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var buf strings.Builder
+
+	buf.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			buf.WriteString(".*")
+			i++
+		case c == '*':
+			buf.WriteString("[^/]*")
+		case c == '?':
+			buf.WriteString("[^/]")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	buf.WriteString("$")
+
+	return regexp.Compile(buf.String())
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"testing"
+	"time"
+)
+
+func memSetup() Backend {
+	b, err := DialBackend("mem:")
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestMemRevisions(t *testing.T) {
+	b := memSetup()
+
+	rev1, err := b.Set("/a", 0, []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev2, err := b.Set("/b", 0, []byte("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev2 <= rev1 {
+		t.Errorf("expected increasing revisions, got %d and %d", rev1, rev2)
+	}
+
+	rev, err := b.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != rev2 {
+		t.Errorf("expected latest rev %d, got %d", rev2, rev)
+	}
+}
+
+func TestMemRevMismatch(t *testing.T) {
+	b := memSetup()
+
+	rev1, _ := b.Set("/a", 0, []byte("1"))
+	rev2, err := b.Set("/a", rev1, []byte("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newrev, err := b.Set("/a", rev1, []byte("3"))
+	if err == nil {
+		t.Error("expected REV_MISMATCH on stale set")
+	}
+	if newrev != 0 {
+		t.Errorf("expected rev 0 on failed set, got %d", newrev)
+	}
+
+	err = b.Del("/a", rev1)
+	if err == nil {
+		t.Error("expected REV_MISMATCH on stale del")
+	}
+
+	if _, err = b.Set("/a", -1, []byte("4")); err != nil {
+		t.Errorf("expected unconditional set to succeed: %s", err)
+	}
+	if err = b.Del("/a", rev2+1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemDirectories(t *testing.T) {
+	b := memSetup()
+
+	b.Set("/dir/sub/file", 0, []byte("x"))
+	rev, _ := b.Set("/dir/file", 0, []byte("y"))
+
+	n, filerev, err := b.Stat("/dir", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filerev >= 0 {
+		t.Errorf("expected negative rev for directory, got %d", filerev)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 entries, got %d", n)
+	}
+
+	names, err := b.Getdir("/dir", rev, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "file" || names[1] != "sub" {
+		t.Errorf("unexpected entries %v", names)
+	}
+
+	if _, err = b.Set("/dir", -1, []byte{}); err == nil {
+		t.Error("expected ISDIR setting a directory")
+	}
+	if _, err = b.Set("/dir/file/x", -1, []byte{}); err == nil {
+		t.Error("expected NOTDIR setting below a file")
+	}
+	if _, err = b.Getdir("/missing", rev, 0, -1); !IsErrNoEnt(err) {
+		t.Errorf("expected NoEnt error, got %v", err)
+	}
+}
+
+func TestMemHistoricalReads(t *testing.T) {
+	b := memSetup()
+
+	rev1, _ := b.Set("/a", 0, []byte("old"))
+	rev2, _ := b.Set("/a", rev1, []byte("new"))
+	b.Set("/dir/x", 0, []byte{})
+	b.Del("/a", rev2)
+	rev3, _ := b.Rev()
+
+	val, filerev, err := b.Get("/a", &rev1)
+	if err != nil || string(val) != "old" || filerev != rev1 {
+		t.Errorf("expected 'old' at %d, got '%s' at %d (%v)", rev1, val, filerev, err)
+	}
+	val, filerev, err = b.Get("/a", &rev2)
+	if err != nil || string(val) != "new" || filerev != rev2 {
+		t.Errorf("expected 'new' at %d, got '%s' at %d (%v)", rev2, val, filerev, err)
+	}
+	_, filerev, err = b.Get("/a", &rev3)
+	if err != nil || filerev != 0 {
+		t.Errorf("expected missing file at %d, got rev %d (%v)", rev3, filerev, err)
+	}
+
+	zero := int64(0)
+	_, filerev, _ = b.Stat("/dir", &zero)
+	if filerev != 0 {
+		t.Errorf("expected directory to be missing at rev 0")
+	}
+}
+
+func TestMemWaitGlob(t *testing.T) {
+	b := memSetup()
+
+	b.Set("/tickets/1/claims/host", 0, []byte{})
+	b.Set("/tickets/1/op", 0, []byte("start"))
+	rev, _ := b.Set("/tickets/1/status", 0, []byte("unclaimed"))
+
+	ev, err := b.Wait("/tickets/*/status", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Rev != rev || ev.Path != "/tickets/1/status" || !ev.IsSet() {
+		t.Errorf("unexpected change %#v", ev)
+	}
+
+	ev, err = b.Wait("/tickets/**", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Path != "/tickets/1/claims/host" {
+		t.Errorf("expected '**' to match across '/', got %#v", ev)
+	}
+}
+
+func TestMemWaitBlocks(t *testing.T) {
+	b := memSetup()
+	rev, _ := b.Rev()
+
+	c := make(chan Change)
+
+	go func() {
+		ev, err := b.Wait("/apps/**", rev+1)
+		if err != nil {
+			t.Error(err)
+		}
+		c <- ev
+	}()
+
+	b.Set("/other", 0, []byte{})
+	b.Set("/apps/cat/registered", 0, []byte("now"))
+	b.Del("/other", -1)
+
+	select {
+	case ev := <-c:
+		if ev.Path != "/apps/cat/registered" || string(ev.Body) != "now" {
+			t.Errorf("unexpected change %#v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected change, got timeout")
+	}
+
+	ev, err := b.Wait("/other", rev+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ev.IsSet() {
+		t.Error("expected first change to be a set")
+	}
+	ev, _ = b.Wait("/other", ev.Rev+1)
+	if !ev.IsDel() {
+		t.Error("expected second change to be a del")
+	}
+}
+
+func TestMemCloseUnblocksWait(t *testing.T) {
+	b := memSetup()
+	c := make(chan error)
+
+	go func() {
+		_, err := b.Wait("**", 1)
+		c <- err
+	}()
+
+	b.Close()
+
+	select {
+	case err := <-c:
+		if err == nil {
+			t.Error("expected error from closed backend")
+		}
+	case <-time.After(time.Second):
+		t.Error("wait didn't return after close")
+	}
+}
+
+func TestMemSharedStore(t *testing.T) {
+	b1, _ := DialBackend("mem:shared-test")
+	b2, _ := DialBackend("mem:shared-test")
+	b3, _ := DialBackend("mem:")
+
+	rev, _ := b1.Set("/shared", -1, []byte("x"))
+
+	if _, filerev, _ := b2.Get("/shared", nil); filerev != rev {
+		t.Error("expected named stores to be shared")
+	}
+	if _, filerev, _ := b3.Get("/shared", nil); filerev != 0 {
+		t.Error("expected anonymous store to be empty")
+	}
+}
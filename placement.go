@@ -0,0 +1,139 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+)
+
+// Placement restricts the hosts which may claim a ticket. A nil
+// Placement allows any host. Host names are the names hosts are
+// registered with, see Host.
+type Placement struct {
+	Host         string            `json:"host,omitempty"`          // The only host allowed
+	Labels       map[string]string `json:"labels,omitempty"`        // Labels the host must carry
+	AntiAffinity bool              `json:"anti-affinity,omitempty"` // Spread instances of the proctype over hosts
+}
+
+func (p *Placement) isZero() bool {
+	return p == nil || (p.Host == "" && len(p.Labels) == 0 && !p.AntiAffinity)
+}
+
+// check returns why host can't claim the ticket at the snapshot's
+// revision, or "" if it can. With AntiAffinity, hosts running a live
+// instance of the ticket's proctype, or holding a claim on another
+// start ticket of it, are ineligible.
+func (p *Placement) check(s Snapshot, t *Ticket, host string) (reason string, err error) {
+	if p.isZero() {
+		return
+	}
+	if p.Host != "" && p.Host != host {
+		return fmt.Sprintf("ticket is placed on host %s", p.Host), nil
+	}
+
+	if len(p.Labels) > 0 {
+		h, e := GetHost(s, host)
+		if IsErrNoEnt(e) {
+			return fmt.Sprintf("host %s isn't registered", host), nil
+		}
+		if e != nil {
+			return "", e
+		}
+
+		keys := []string{}
+		for k := range p.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if v, ok := h.Labels[k]; !ok || v != p.Labels[k] {
+				return fmt.Sprintf("host %s lacks label %s=%s", host, k, p.Labels[k]), nil
+			}
+		}
+	}
+
+	if p.AntiAffinity {
+		return antiAffinity(s, t, host)
+	}
+	return
+}
+
+func antiAffinity(s Snapshot, t *Ticket, host string) (reason string, err error) {
+	instances, err := Instances(s, InstanceFilter{App: t.AppName, ProcType: t.ProcessName, Host: host})
+	if err != nil {
+		return
+	}
+	for _, i := range instances {
+		if i.State != InsStateExited && i.State != InsStateDead {
+			return fmt.Sprintf("host %s runs instance %s of %s:%s", host, i.Name, t.AppName, t.ProcessName), nil
+		}
+	}
+
+	ids, err := fsckGetdir(s, TICKETS_PATH)
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		if id == fmt.Sprint(t.Id) {
+			continue
+		}
+		dir := path.Join(TICKETS_PATH, id)
+
+		exists, _, e := s.Exists(path.Join(dir, "claims", host))
+		if e != nil {
+			return "", e
+		}
+		if !exists {
+			continue
+		}
+		status, _, e := s.Get(path.Join(dir, "status"))
+		if e != nil && !IsErrNoEnt(e) {
+			return "", e
+		}
+		if TicketStatus(status) != TicketStatusClaimed {
+			continue
+		}
+		// Malformed tickets can't be claimed, so they're skipped.
+		f, e := Get(s, path.Join(dir, "op"), new(ListCodec))
+		if IsErrNoEnt(e) {
+			continue
+		}
+		if e != nil {
+			return "", e
+		}
+		op := f.Value.([]string)
+		if len(op) < 4 {
+			continue
+		}
+
+		if op[0] == t.AppName && ProcessName(op[2]) == t.ProcessName && NewOperationType(op[3]) == OpStart {
+			return fmt.Sprintf("host %s claimed ticket %s of %s:%s", host, id, t.AppName, t.ProcessName), nil
+		}
+	}
+	return
+}
+
+// getPlacement reads the placement of the ticket in dir. It
+// returns nil if the ticket can be claimed by any host.
+func getPlacement(s Snapshot, dir string) (p *Placement, err error) {
+	value, _, err := s.GetBytes(path.Join(dir, "placement"))
+	if IsErrNoEnt(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+
+	p = &Placement{}
+	if err = json.Unmarshal(value, p); err != nil {
+		return nil, NewError(ErrInvalidState, fmt.Sprintf("invalid placement in %s: %s", dir, err))
+	}
+	return
+}
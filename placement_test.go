@@ -0,0 +1,180 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"errors"
+	"testing"
+)
+
+func placementSetup() (s Snapshot) {
+	s, err := testDial("/placement-test")
+	if err != nil {
+		panic(err)
+	}
+	s.conn.Del("/", s.Rev)
+
+	s = s.FastForward(-1)
+
+	r, err := Init(s)
+	if err != nil {
+		panic(err)
+	}
+
+	h := NewHost("box-a", 4, 1024, s.FastForward(r))
+	h.Labels = map[string]string{"zone": "eu", "disk": "ssd"}
+	if h, err = h.Register(); err != nil {
+		panic(err)
+	}
+	h = NewHost("box-b", 4, 1024, h.Snapshot)
+	h.Labels = map[string]string{"zone": "eu"}
+	if h, err = h.Register(); err != nil {
+		panic(err)
+	}
+
+	return h.Snapshot
+}
+
+func TestPlacementHost(t *testing.T) {
+	s := placementSetup()
+
+	ticket, err := CreatePlacedTicket("place", "abc", "web", OpStart, &Placement{Host: "box-a"}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := ticket.Eligible("box-b"); ok || err != nil {
+		t.Errorf("expected box-b to be ineligible, got %v, %v", ok, err)
+	}
+	if _, err = ticket.Claim("box-b"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+	if _, err = ticket.Claim("box-a"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPlacementStored(t *testing.T) {
+	s := placementSetup()
+
+	ticket, err := CreatePlacedTicket("place", "abc", "web", OpStart, &Placement{Host: "box-a"}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := *ticket
+	stale.Placement = nil
+
+	if _, err = stale.Claim("box-b"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestPlacementLabels(t *testing.T) {
+	s := placementSetup()
+
+	p := &Placement{Labels: map[string]string{"zone": "eu", "disk": "ssd"}}
+	ticket, err := CreatePlacedTicket("place", "abc", "web", OpStart, p, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := ticket.Eligible("box-b"); ok || err != nil {
+		t.Errorf("expected box-b to be ineligible, got %v, %v", ok, err)
+	}
+	if ok, err := ticket.Eligible("box-unknown"); ok || err != nil {
+		t.Errorf("expected unregistered host to be ineligible, got %v, %v", ok, err)
+	}
+	if ok, err := ticket.Eligible("box-a"); !ok || err != nil {
+		t.Errorf("expected box-a to be eligible, got %v, %v", ok, err)
+	}
+}
+
+func TestPlacementAntiAffinity(t *testing.T) {
+	s := placementSetup()
+	p := &Placement{AntiAffinity: true}
+
+	ins, err := NewInstance("web", "abc", "place", "10.0.0.1:8000", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins.Hostname = "box-a"
+	if ins, err = ins.Register(); err != nil {
+		t.Fatal(err)
+	}
+
+	ticket, err := CreatePlacedTicket("place", "abc", "web", OpStart, p, ins.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := ticket.Eligible("box-a"); ok || err != nil {
+		t.Errorf("expected box-a to be ineligible, got %v, %v", ok, err)
+	}
+	if _, err = ticket.Claim("box-b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// box-b is about to start an instance for the claimed ticket.
+	other, err := CreatePlacedTicket("place", "abc", "web", OpStart, p, ins.Snapshot.FastForward(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := other.Eligible("box-b"); ok || err != nil {
+		t.Errorf("expected box-b to be ineligible, got %v, %v", ok, err)
+	}
+
+	// Other proctypes aren't affected.
+	worker, err := CreatePlacedTicket("place", "abc", "worker", OpStart, p, other.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := worker.Eligible("box-a"); !ok || err != nil {
+		t.Errorf("expected box-a to be eligible, got %v, %v", ok, err)
+	}
+}
+
+func TestPlacementAntiAffinityMalformedTicket(t *testing.T) {
+	s := placementSetup()
+
+	// A claimed ticket with a truncated op file, and one without any.
+	if _, err := s.conn.Set("tickets/998/op", -1, []byte("place abc")); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"tickets/998", "tickets/999"} {
+		if _, err := s.conn.Set(dir+"/status", -1, []byte(TicketStatusClaimed)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.conn.Set(dir+"/claims/box-a", -1, []byte("now")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ticket, err := CreatePlacedTicket("place", "abc", "web", OpStart, &Placement{AntiAffinity: true}, s.FastForward(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := ticket.Eligible("box-a"); !ok || err != nil {
+		t.Errorf("expected box-a to be eligible, got %v, %v", ok, err)
+	}
+	if _, err = ticket.Claim("box-a"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTicketWatchFor(t *testing.T) {
+	s := placementSetup()
+	l := make(chan *Ticket)
+
+	go WatchTicketFor(s, "box-b", l, make(chan error))
+
+	_, err := CreatePlacedTicket("place", "abc", "web", OpStart, &Placement{Host: "box-a"}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CreatePlacedTicket("place", "abc", "worker", OpStart, &Placement{Host: "box-b"}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectTicket("place", "abc", "worker", OpStart, l, t)
+}
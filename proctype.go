@@ -6,8 +6,8 @@
 package visor
 
 import (
-	"errors"
 	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -55,22 +55,18 @@ func (p *ProcType) Register() (ptype *ProcType, err error) {
 
 	p.Port, err = ClaimNextPort(p.Snapshot)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("couldn't claim port: %s", err.Error()))
+		return nil, fmt.Errorf("couldn't claim port: %w", err)
 	}
 
-	port := &File{p.Snapshot, -1, p.Path.Prefix("port"), p.Port, new(IntCodec)}
+	txn := p.Snapshot.Txn()
+	txn.Set(p.Path.Prefix("port"), strconv.Itoa(p.Port))
+	txn.Set(p.Path.Prefix("registered"), time.Now().UTC().String())
 
-	port, err = port.Create()
+	s, err := txn.Commit()
 	if err != nil {
 		return p, err
 	}
-
-	rev, err := p.Set("registered", time.Now().UTC().String())
-
-	if err != nil {
-		return p, err
-	}
-	ptype = p.FastForward(rev)
+	ptype = p.FastForward(s.Rev)
 
 	return
 }
@@ -0,0 +1,198 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ConnState is the state of the connection to the coordinator.
+type ConnState int
+
+const (
+	ConnConnected    ConnState = iota // Connected to the coordinator
+	ConnDisconnected                  // Connection lost, reconnecting
+	ConnClosed                        // Closed with (*Conn).Close
+)
+
+const (
+	DEFAULT_MAX_RECONNECTS = 8
+	DEFAULT_MIN_BACKOFF    = 100 * time.Millisecond
+	DEFAULT_MAX_BACKOFF    = 5 * time.Second
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnConnected:
+		return "connected"
+	case ConnDisconnected:
+		return "disconnected"
+	case ConnClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// State returns the current state of the connection.
+func (c *Conn) State() ConnState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state
+}
+
+// OnStateChange registers fn to be called whenever the state of the
+// connection changes. err is the error which caused the connection
+// to be lost, if any. fn must not block.
+func (c *Conn) OnStateChange(fn func(state ConnState, err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hooks = append(c.hooks, fn)
+}
+
+func (c *Conn) setState(state ConnState, err error) {
+	c.mu.Lock()
+	if c.state == state || c.state == ConnClosed {
+		c.mu.Unlock()
+		return
+	}
+	c.state = state
+	hooks := c.hooks
+	c.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn(state, err)
+	}
+}
+
+// backend returns the current backend along with its generation,
+// which is increased whenever the connection is reestablished.
+func (c *Conn) backend() (Backend, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn, c.gen
+}
+
+// lost reports whether err means that the connection was lost
+// and can be reestablished.
+func (c *Conn) lost(err error) bool {
+	return errors.Is(err, ErrClosed) && c.dial != nil && c.State() != ConnClosed
+}
+
+// do runs op on the current backend. If the connection is lost, it
+// reconnects and runs op again if retry is set. Only idempotent
+// operations may be retried.
+func (c *Conn) do(retry bool, op func(b Backend) error) (err error) {
+	for i := 1; ; i++ {
+		b, gen := c.backend()
+
+		err = op(b)
+		if !c.lost(err) {
+			return
+		}
+		if c.reconnect(context.Background(), gen, err) != nil || !retry || i >= c.maxReconnects() {
+			return
+		}
+	}
+}
+
+// reconnect replaces the backend of generation gen, which failed with
+// cause. Dialing is retried with exponential backoff, up to MaxReconnects
+// times. If another caller is already reconnecting, it waits for the
+// outcome instead.
+func (c *Conn) reconnect(ctx context.Context, gen int, cause error) (err error) {
+	c.mu.Lock()
+	switch {
+	case c.state == ConnClosed:
+		c.mu.Unlock()
+		return ErrClosed
+	case c.gen != gen:
+		c.mu.Unlock()
+		return nil
+	case c.redialing != nil:
+		redialing := c.redialing
+		c.mu.Unlock()
+
+		select {
+		case <-redialing:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if _, g := c.backend(); g == gen {
+			return cause
+		}
+		return nil
+	}
+	redialing := make(chan struct{})
+	c.redialing = redialing
+	old := c.conn
+	c.mu.Unlock()
+
+	old.Close()
+	c.setState(ConnDisconnected, cause)
+
+	b, err := c.redial(ctx)
+
+	c.mu.Lock()
+	if err == nil && c.state == ConnClosed {
+		b.Close()
+		err = ErrClosed
+	}
+	if err == nil {
+		c.conn = b
+		c.gen++
+	}
+	c.redialing = nil
+	c.mu.Unlock()
+	close(redialing)
+
+	if err == nil {
+		c.setState(ConnConnected, nil)
+	}
+	return
+}
+
+func (c *Conn) redial(ctx context.Context) (b Backend, err error) {
+	backoff := c.MinBackoff
+	if backoff <= 0 {
+		backoff = DEFAULT_MIN_BACKOFF
+	}
+	max := c.MaxBackoff
+	if max <= 0 {
+		max = DEFAULT_MAX_BACKOFF
+	}
+
+	for i := 0; i < c.maxReconnects(); i++ {
+		if i > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if backoff *= 2; backoff > max {
+				backoff = max
+			}
+		}
+		if c.State() == ConnClosed {
+			return nil, ErrClosed
+		}
+		if b, err = c.dial(); err == nil {
+			return
+		}
+	}
+	return
+}
+
+func (c *Conn) maxReconnects() int {
+	if c.MaxReconnects <= 0 {
+		return DEFAULT_MAX_RECONNECTS
+	}
+	return c.MaxReconnects
+}
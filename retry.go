@@ -0,0 +1,272 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+)
+
+// DEAD_TICKETS_PATH is the dead-letter area, holding the ids of
+// tickets which failed on all attempts.
+const DEAD_TICKETS_PATH = "dead-tickets"
+
+const (
+	DEFAULT_TICKET_MAX_ATTEMPTS = 3
+	DEFAULT_TICKET_MIN_BACKOFF  = 10 * time.Second
+	DEFAULT_TICKET_MAX_BACKOFF  = 10 * time.Minute
+)
+
+// Attempt is a claim of a ticket by a host. Failed and Reason
+// are set once the attempt failed.
+type Attempt struct {
+	Host    string     `json:"host"`
+	Claimed time.Time  `json:"claimed"`
+	Failed  *time.Time `json:"failed,omitempty"`
+	Reason  string     `json:"reason,omitempty"`
+}
+
+// Fail records that the host's attempt failed for the given reason and
+// releases the claim. If the ticket has attempts left, its status is
+// set to TicketStatusRetry until the backoff passed, then SweepTickets
+// requeues it. Otherwise the ticket is marked dead and moved into the
+// dead-letter area, see DeadTickets.
+func (t *Ticket) Fail(host string, reason string) (t1 *Ticket, err error) {
+	return t.fail(host, reason, nil)
+}
+
+// fail is Fail, storing the result if the ticket is dead.
+func (t *Ticket) fail(host string, reason string, result *TicketResult) (t1 *Ticket, err error) {
+	s := t.Snapshot.FastForward(-1)
+
+	exists, _, err := s.Exists(t.claimPath(host))
+	if err != nil {
+		return t, err
+	}
+	if !exists {
+		return t, ErrUnauthorized
+	}
+	status, _, err := s.Get(t.Path.Prefix("status"))
+	if err != nil {
+		return t, err
+	}
+	if TicketStatus(status) != TicketStatusClaimed {
+		return t, NewError(ErrInvalidState, fmt.Sprintf("can't fail ticket, status is '%s'", status))
+	}
+
+	t1, err = GetTicket(s, t.Id)
+	if err != nil {
+		return t, err
+	}
+
+	txn := s.Txn()
+	if err = t1.failAttempt(txn, reason); err != nil {
+		return t, err
+	}
+	txn.Del(t.claimPath(host))
+	if err = t1.delLease(s, txn); err != nil {
+		return t, err
+	}
+
+	now := time.Now().UTC()
+
+	if t1.attemptsLeft() > 0 {
+		t1.Status = TicketStatusRetry
+		t1.RetryAt = now.Add(t1.backoff())
+		txn.Set(t.Path.Prefix("retry-at"), t1.RetryAt.String())
+	} else {
+		t1.Status = TicketStatusDead
+		t1.Finished = now
+		txn.Set(t.Path.Prefix("finished"), now.String())
+		txn.Set(path.Join(DEAD_TICKETS_PATH, strconv.FormatInt(t.Id, 10)), now.String())
+		if err = t1.setResult(s, txn, result); err != nil {
+			return t, err
+		}
+	}
+	tr, err := t1.transition(s, txn, t1.Status, host, now)
+	if err != nil {
+		return t, err
+	}
+
+	s, err = txn.Commit()
+	if err != nil {
+		return t, err
+	}
+	t1.Lease = time.Time{}
+	t1.Timeline = append(t1.Timeline, tr)
+	if t1.Status == TicketStatusDead {
+		t1.Result = result
+	}
+
+	return t1.FastForward(s.Rev), nil
+}
+
+// Retry takes a dead ticket out of the dead-letter area and makes it
+// claimable again, with a fresh set of attempts and without a result.
+func (t *Ticket) Retry() (t1 *Ticket, err error) {
+	s := t.Snapshot.FastForward(-1)
+
+	t1, err = GetTicket(s, t.Id)
+	if err != nil {
+		return t, err
+	}
+	if t1.Status != TicketStatusDead {
+		return t, NewError(ErrInvalidState, fmt.Sprintf("can't retry ticket, status is '%s'", t1.Status))
+	}
+
+	hosts, err := fsckGetdir(s, t.Path.Prefix("claims"))
+	if err != nil {
+		return t, err
+	}
+	deadPath := path.Join(DEAD_TICKETS_PATH, strconv.FormatInt(t.Id, 10))
+
+	exists, _, err := s.Exists(deadPath)
+	if err != nil {
+		return t, err
+	}
+
+	txn := s.Txn()
+	txn.Set(t.Path.Prefix("attempts-base"), strconv.Itoa(len(t1.Attempts)))
+	for _, host := range hosts {
+		txn.Del(t.claimPath(host))
+	}
+	if exists {
+		txn.Del(deadPath)
+	}
+	if !t1.Finished.IsZero() {
+		txn.Del(t.Path.Prefix("finished"))
+	}
+	if t1.Result != nil {
+		txn.Del(t.Path.Prefix("result"))
+	}
+	tr, err := t1.transition(s, txn, TicketStatusUnClaimed, "", time.Now().UTC())
+	if err != nil {
+		return t, err
+	}
+
+	s, err = txn.Commit()
+	if err != nil {
+		return t, err
+	}
+	t1.Status = TicketStatusUnClaimed
+	t1.Finished = time.Time{}
+	t1.Result = nil
+	t1.Timeline = append(t1.Timeline, tr)
+	t1.attemptsBase = len(t1.Attempts)
+
+	return t1.FastForward(s.Rev), nil
+}
+
+// DeadTickets returns the tickets in the dead-letter area.
+func DeadTickets(s Snapshot) (tickets []*Ticket, err error) {
+	tickets = []*Ticket{}
+
+	ids, err := fsckGetdir(s, DEAD_TICKETS_PATH)
+	if err != nil {
+		return
+	}
+
+	for _, idStr := range ids {
+		var t *Ticket
+
+		id, e := strconv.ParseInt(idStr, 10, 64)
+		if e != nil {
+			continue
+		}
+		t, err = GetTicket(s, id)
+		if IsErrNoEnt(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		tickets = append(tickets, t)
+	}
+	return tickets, nil
+}
+
+// LastAttempt returns the latest attempt, or nil if the
+// ticket was never claimed.
+func (t *Ticket) LastAttempt() *Attempt {
+	if len(t.Attempts) == 0 {
+		return nil
+	}
+	return &t.Attempts[len(t.Attempts)-1]
+}
+
+// attemptsLeft returns the number of attempts the ticket has left.
+func (t *Ticket) attemptsLeft() int {
+	max := t.MaxAttempts
+	if max <= 0 {
+		max = DEFAULT_TICKET_MAX_ATTEMPTS
+	}
+	return max - (len(t.Attempts) - t.attemptsBase)
+}
+
+// backoff returns how long to wait before the next attempt,
+// doubling with every failed attempt.
+func (t *Ticket) backoff() time.Duration {
+	backoff := DEFAULT_TICKET_MIN_BACKOFF
+
+	for i := t.attemptsBase + 1; i < len(t.Attempts); i++ {
+		if backoff *= 2; backoff > DEFAULT_TICKET_MAX_BACKOFF {
+			return DEFAULT_TICKET_MAX_BACKOFF
+		}
+	}
+	return backoff
+}
+
+// addAttempt adds the start of a new attempt by host to txn.
+func (t *Ticket) addAttempt(txn *Txn, host string, claimed time.Time) error {
+	a := Attempt{Host: host, Claimed: claimed}
+
+	value, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	txn.SetBytes(t.Path.Prefix("attempts", strconv.Itoa(len(t.Attempts)+1)), value)
+	t.Attempts = append(t.Attempts, a)
+
+	return nil
+}
+
+// failAttempt adds the failure of the latest attempt to txn.
+func (t *Ticket) failAttempt(txn *Txn, reason string) error {
+	a := t.LastAttempt()
+	if a == nil {
+		return nil
+	}
+	failed := time.Now().UTC()
+	a.Failed = &failed
+	a.Reason = reason
+
+	value, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	txn.SetBytes(t.Path.Prefix("attempts", strconv.Itoa(len(t.Attempts))), value)
+
+	return nil
+}
+
+// getAttempts reads the attempts, ordered by number.
+func (t *Ticket) getAttempts() (attempts []Attempt, err error) {
+	attempts = []Attempt{}
+
+	err = t.getSeq("attempts", func(n int, value []byte) error {
+		var a Attempt
+
+		if e := json.Unmarshal(value, &a); e != nil {
+			return NewError(ErrInvalidState, fmt.Sprintf("invalid attempt %d of ticket %d: %s", n, t.Id, e))
+		}
+		attempts = append(attempts, a)
+		return nil
+	})
+	return
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func retrySetup(maxAttempts int) (t *Ticket) {
+	s, err := testDial("/retry-test")
+	if err != nil {
+		panic(err)
+	}
+	s.conn.Del("/", s.Rev)
+
+	t = &Ticket{
+		AppName:      "retry",
+		RevisionName: "abc",
+		ProcessName:  "web",
+		Op:           OpStart,
+		Status:       TicketStatusUnClaimed,
+		MaxAttempts:  maxAttempts,
+		Path:         Path{s.FastForward(-1), ""},
+	}
+	t, err = t.Create()
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+func TestTicketFail(t *testing.T) {
+	ticket := retrySetup(2)
+
+	ticket, err := ticket.Claim("host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ticket.Fail("host-b", "boom"); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+
+	ticket, err = ticket.Fail("host-a", "port in use")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err = GetTicket(ticket.Snapshot, ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Status != TicketStatusRetry {
+		t.Errorf("expected status retry, got %s", ticket.Status)
+	}
+	if d := ticket.RetryAt.Sub(time.Now()); d <= 0 || d > DEFAULT_TICKET_MIN_BACKOFF {
+		t.Errorf("expected retry within %s, got %s", DEFAULT_TICKET_MIN_BACKOFF, ticket.RetryAt)
+	}
+	if len(ticket.Attempts) != 1 {
+		t.Fatalf("expected 1 attempt, got %d", len(ticket.Attempts))
+	}
+	if a := ticket.Attempts[0]; a.Host != "host-a" || a.Reason != "port in use" || a.Failed == nil {
+		t.Errorf("unexpected attempt %#v", a)
+	}
+	if _, err = ticket.Claim("host-b"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState while backing off, got %v", err)
+	}
+}
+
+func TestTicketFailRequeue(t *testing.T) {
+	ticket := retrySetup(2)
+
+	ticket, err := ticket.Claim("host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket, err = ticket.Fail("host-a", "boom"); err != nil {
+		t.Fatal(err)
+	}
+
+	requeued, err := SweepTickets(ticket.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requeued) != 0 {
+		t.Errorf("expected no ticket to be requeued before the backoff passed, got %v", requeued)
+	}
+
+	if _, err = ticket.Set("retry-at", time.Now().Add(-time.Second).UTC().String()); err != nil {
+		t.Fatal(err)
+	}
+	if requeued, err = SweepTickets(ticket.Snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if len(requeued) != 1 || requeued[0].Status != TicketStatusUnClaimed {
+		t.Fatalf("expected ticket to be requeued, got %v", requeued)
+	}
+
+	ticket, err = requeued[0].Claim("host-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ticket.Attempts) != 2 {
+		t.Errorf("expected 2 attempts, got %d", len(ticket.Attempts))
+	}
+}
+
+func TestTicketDeadLetter(t *testing.T) {
+	ticket := retrySetup(1)
+
+	ticket, err := ticket.Claim("host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket, err = ticket.Dead("host-a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Status != TicketStatusDead {
+		t.Errorf("expected status dead, got %s", ticket.Status)
+	}
+
+	dead, err := DeadTickets(ticket.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Id != ticket.Id {
+		t.Fatalf("expected ticket %d to be dead, got %v", ticket.Id, dead)
+	}
+
+	ticket, err = dead[0].Retry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dead, _ = DeadTickets(ticket.Snapshot); len(dead) != 0 {
+		t.Errorf("expected no dead tickets, got %v", dead)
+	}
+	if _, err = ticket.Retry(); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState, got %v", err)
+	}
+
+	// Retried tickets get a fresh set of attempts.
+	if ticket, err = ticket.Claim("host-b"); err != nil {
+		t.Fatal(err)
+	}
+	if ticket, err = ticket.Fail("host-b", "boom"); err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Status != TicketStatusDead || len(ticket.Attempts) != 2 {
+		t.Errorf("expected dead ticket with 2 attempts, got %s with %d", ticket.Status, len(ticket.Attempts))
+	}
+}
+
+func TestTicketBackoff(t *testing.T) {
+	ticket := &Ticket{}
+	expected := []time.Duration{
+		DEFAULT_TICKET_MIN_BACKOFF,
+		DEFAULT_TICKET_MIN_BACKOFF,
+		2 * DEFAULT_TICKET_MIN_BACKOFF,
+		4 * DEFAULT_TICKET_MIN_BACKOFF,
+	}
+
+	for i, d := range expected {
+		if b := ticket.backoff(); b != d {
+			t.Errorf("expected backoff %s after %d attempts, got %s", d, i, b)
+		}
+		ticket.Attempts = append(ticket.Attempts, Attempt{})
+	}
+	for i := 0; i < 20; i++ {
+		ticket.Attempts = append(ticket.Attempts, Attempt{})
+	}
+	if b := ticket.backoff(); b != DEFAULT_TICKET_MAX_BACKOFF {
+		t.Errorf("expected backoff %s, got %s", DEFAULT_TICKET_MAX_BACKOFF, b)
+	}
+}
@@ -51,16 +51,16 @@ func (r *Revision) Register() (revision *Revision, err error) {
 		return nil, ErrKeyConflict
 	}
 
-	rev, err := r.Set("archive-url", r.ArchiveUrl)
-	if err != nil {
-		return
-	}
-	rev, err = r.Set("registered", time.Now().UTC().String())
+	txn := r.Snapshot.Txn()
+	txn.Set(r.Path.Prefix("archive-url"), r.ArchiveUrl)
+	txn.Set(r.Path.Prefix("registered"), time.Now().UTC().String())
+
+	s, err := txn.Commit()
 	if err != nil {
 		return
 	}
 
-	revision = r.FastForward(rev)
+	revision = r.FastForward(s.Rev)
 
 	return
 }
@@ -0,0 +1,121 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// SCHEMA_VERSION is the version of the registry layout this package
+// reads and writes. Trees without a version predate versioning and
+// are at version 0.
+const SCHEMA_VERSION int = 2
+const SCHEMA_PATH string = "/schema-version"
+
+var ErrSchemaTooNew = errors.New("schema version is newer than supported")
+
+// Migration upgrades the registry layout from the version before
+// Version to Version. Run adds the writes it needs to txn, which is
+// committed together with the new version.
+type Migration struct {
+	Version     int
+	Description string
+	Run         func(s Snapshot, txn *Txn) error
+}
+
+// migrations holds the steps to SCHEMA_VERSION, ordered by version.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "record schema version",
+		Run:         func(s Snapshot, txn *Txn) error { return nil },
+	},
+	{
+		Version:     2,
+		Description: "store instance info as JSON",
+		Run:         migrateInstanceInfo,
+	},
+}
+
+// SchemaVersion returns the version of the registry layout at the
+// snapshot's revision.
+func SchemaVersion(s Snapshot) (version int, err error) {
+	f, err := s.GetFile(SCHEMA_PATH, new(IntCodec))
+	if IsErrNoEnt(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return
+	}
+	return f.Value.(int), nil
+}
+
+// CheckSchema fails with ErrSchemaTooNew if the registry layout
+// is newer than this package understands.
+func CheckSchema(s Snapshot) error {
+	version, err := SchemaVersion(s)
+	if err != nil {
+		return err
+	}
+	if version > SCHEMA_VERSION {
+		return &Error{
+			Err:     ErrSchemaTooNew,
+			Message: fmt.Sprintf("schema version %d is newer than supported version %d", version, SCHEMA_VERSION),
+			Path:    SCHEMA_PATH,
+		}
+	}
+	return nil
+}
+
+// PendingMigrations returns the migrations which have yet to be applied,
+// in the order they are applied by Migrate.
+func PendingMigrations(s Snapshot) (pending []Migration, err error) {
+	if err = CheckSchema(s); err != nil {
+		return
+	}
+	version, err := SchemaVersion(s)
+	if err != nil {
+		return
+	}
+
+	pending = []Migration{}
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return
+}
+
+// Migrate applies the pending migrations one after another, each one
+// together with its version. It returns the migrations applied, which
+// are all pending ones unless an error occurs.
+func Migrate(s Snapshot) (s1 Snapshot, applied []Migration, err error) {
+	s1 = s.FastForward(-1)
+	applied = []Migration{}
+
+	pending, err := PendingMigrations(s1)
+	if err != nil {
+		return
+	}
+
+	for _, m := range pending {
+		txn := s1.Txn()
+
+		if err = m.Run(s1, txn); err == nil {
+			txn.Set(SCHEMA_PATH, strconv.Itoa(m.Version))
+			s1, err = txn.Commit()
+		}
+		if err != nil {
+			err = fmt.Errorf("migration to version %d failed: %w", m.Version, err)
+			return
+		}
+		applied = append(applied, m)
+	}
+	return
+}
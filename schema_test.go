@@ -0,0 +1,159 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func schemaSetup() (s Snapshot) {
+	s, err := testDial("/schema-test")
+	if err != nil {
+		panic(err)
+	}
+	s.Del("/")
+	s = s.FastForward(-1)
+
+	return
+}
+
+func TestSchemaInit(t *testing.T) {
+	s := schemaSetup()
+
+	rev, err := Init(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := SchemaVersion(s.FastForward(rev))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != SCHEMA_VERSION {
+		t.Errorf("expected schema version %d, got %d", SCHEMA_VERSION, version)
+	}
+
+	pending, err := PendingMigrations(s.FastForward(rev))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected no pending migrations, got %v", pending)
+	}
+}
+
+func TestSchemaMigrate(t *testing.T) {
+	s := schemaSetup()
+
+	// A tree from before schema versioning.
+	s, err := s.Set(START_PORT_PATH, strconv.Itoa(START_PORT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := SchemaVersion(s); version != 0 {
+		t.Errorf("expected schema version 0, got %d", version)
+	}
+
+	s, applied, err := Migrate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("expected %d migrations to be applied, got %d", len(migrations), len(applied))
+	}
+	if version, _ := SchemaVersion(s); version != SCHEMA_VERSION {
+		t.Errorf("expected schema version %d, got %d", SCHEMA_VERSION, version)
+	}
+
+	if _, applied, _ = Migrate(s); len(applied) != 0 {
+		t.Errorf("expected no migrations to be applied, got %v", applied)
+	}
+}
+
+func TestSchemaMigrateFailure(t *testing.T) {
+	s := schemaSetup()
+
+	defer func(m []Migration) { migrations = m }(migrations)
+	migrations = append(migrations, Migration{
+		Version:     SCHEMA_VERSION + 1,
+		Description: "failing migration",
+		Run: func(s Snapshot, txn *Txn) error {
+			txn.Set("/written", "x")
+			return ErrInvalidState
+		},
+	})
+
+	s, applied, err := Migrate(s)
+	if !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState, got %v", err)
+	}
+	if len(applied) != SCHEMA_VERSION {
+		t.Errorf("expected %d migrations to be applied, got %v", SCHEMA_VERSION, applied)
+	}
+	if version, _ := SchemaVersion(s); version != SCHEMA_VERSION {
+		t.Errorf("expected schema version %d, got %d", SCHEMA_VERSION, version)
+	}
+	if exists, _, _ := s.FastForward(-1).Exists("/written"); exists {
+		t.Error("expected writes of failed migration to be discarded")
+	}
+}
+
+func TestSchemaTooNew(t *testing.T) {
+	s := schemaSetup()
+
+	s, err := s.Set(SCHEMA_PATH, strconv.Itoa(SCHEMA_VERSION+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Later dials to the root would be refused.
+	defer s.Del("/")
+
+	if err = CheckSchema(s); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("expected ErrSchemaTooNew, got %v", err)
+	}
+	if _, err = testDial("/schema-test"); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("expected dial to fail with ErrSchemaTooNew, got %v", err)
+	}
+	if _, _, err = Migrate(s); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestSchemaMigrateInstanceInfo(t *testing.T) {
+	s := schemaSetup()
+
+	s, err := s.Set(SCHEMA_PATH, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = s.Set("instances/127-0-0-1-9000/info", "app abc123 web 127.0.0.1 9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, applied, err := Migrate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Version != 2 {
+		t.Errorf("expected migration to version 2, got %v", applied)
+	}
+
+	data, _, err := s.GetBytes("instances/127-0-0-1-9000/info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := InstanceInfo{}
+	if err = json.Unmarshal(data, &info); err != nil {
+		t.Fatalf("expected JSON info, got '%s'", data)
+	}
+	if info.Version != INSTANCE_INFO_VERSION || info.App != "app" || info.Port != 9000 {
+		t.Errorf("unexpected info %#v", info)
+	}
+}
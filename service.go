@@ -79,15 +79,15 @@ func (s *Service) GetEndpoints() (endpoints []*Endpoint, err error) {
 		return
 	}
 
-	addrs, err := s.Getdir(p)
+	names, err := s.Getdir(p)
 	if err != nil {
 		return
 	}
 
-	for _, addr := range addrs {
+	for _, name := range names {
 		var e *Endpoint
 
-		e, err = GetEndpoint(s.Snapshot, s, addr)
+		e, err = GetEndpoint(s.Snapshot, s, endpointAddr(name))
 		if err != nil {
 			return
 		}
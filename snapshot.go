@@ -6,8 +6,8 @@
 package visor
 
 import (
+	"context"
 	"fmt"
-	"github.com/soundcloud/doozer"
 	"path"
 	"strconv"
 )
@@ -27,40 +27,47 @@ type Snapshotable interface {
 	createSnapshot(rev int64) Snapshotable
 }
 
-// Dial calls doozer.Dial and returns a Snapshot of the coordinator
-// at the latest revision.
+// Dial connects to the doozerd instance at addr and returns a Snapshot
+// of the coordinator at the latest revision.
 func Dial(addr string, root string) (s Snapshot, err error) {
-	dconn, err := doozer.Dial(addr)
-	if err != nil {
-		return
-	}
-
-	rev, err := dconn.Rev()
-	if err != nil {
-		return
-	}
-
-	s = Snapshot{rev, &Conn{addr, root, dconn}}
-	return
+	return dialSnapshot(func() (Backend, error) { return dialDoozer(addr) }, addr, root)
 }
 
-// DialUri calls doozer.DialUri and returns a Snapshot of the coordinator cluster
-// at the latest revision.
+// DialUri opens the Backend registered for the scheme of uri, such as
+// "doozer:?ca=localhost:8046", and returns a Snapshot of the coordinator
+// cluster at the latest revision.
 func DialUri(uri string, root string) (s Snapshot, err error) {
-	dconn, err := doozer.DialUri(uri, "")
+	return dialSnapshot(func() (Backend, error) { return DialBackend(uri) }, uri, root)
+}
+
+// dialSnapshot connects with dial, which is kept to reconnect later on.
+// It refuses to connect to trees with a newer schema than supported.
+func dialSnapshot(dial func() (Backend, error), addr string, root string) (s Snapshot, err error) {
+	b, err := dial()
 	if err != nil {
 		return
 	}
-
-	rev, err := dconn.Rev()
+	rev, err := b.Rev()
 	if err != nil {
+		b.Close()
 		return
 	}
 
-	s = Snapshot{rev, &Conn{uri, root, dconn}}
+	s = Snapshot{rev, &Conn{Addr: addr, Root: root, conn: b, dial: dial}}
+
+	if err = CheckSchema(s); err != nil {
+		b.Close()
+		return Snapshot{}, err
+	}
 	return
 }
 
+// Conn returns the connection the snapshot was taken on, which is shared
+// by all snapshots derived from it.
+func (s Snapshot) Conn() *Conn {
+	return s.conn
+}
+
 // Exists checks if the specified path exists at this snapshot's revision
 func (s Snapshot) Exists(path string) (bool, int64, error) {
 	return s.conn.ExistsRev(path, &s.Rev)
@@ -106,16 +113,65 @@ func (s Snapshot) Del(path string) error {
 	return s.conn.Del(path, s.Rev)
 }
 
-// Update checks if the specified path exists, and if so, does a (*Snapshot).Set with the passed value.
+// ExistsContext is like Exists, but returns early with ctx.Err() once ctx is done.
+func (s Snapshot) ExistsContext(ctx context.Context, path string) (bool, int64, error) {
+	return s.conn.ExistsRevContext(ctx, path, &s.Rev)
+}
+
+// GetContext is like Get, but returns early with ctx.Err() once ctx is done.
+func (s Snapshot) GetContext(ctx context.Context, path string) (string, int64, error) {
+	val, rev, err := s.conn.GetContext(ctx, path, &s.Rev)
+	return string(val), rev, err
+}
+
+// GetdirContext is like Getdir, but returns early with ctx.Err() once ctx is done.
+func (s Snapshot) GetdirContext(ctx context.Context, path string) ([]string, error) {
+	return s.conn.GetdirContext(ctx, path, s.Rev)
+}
+
+// SetContext is like Set, but returns early with ctx.Err() once ctx is done.
+// The write may still be applied in that case.
+func (s Snapshot) SetContext(ctx context.Context, path string, val string) (Snapshot, error) {
+	rev, err := s.conn.SetContext(ctx, path, s.Rev, []byte(val))
+	if err != nil {
+		return s, err
+	}
+	return s.FastForward(rev), err
+}
+
+// DelContext is like Del, but returns early with ctx.Err() once ctx is done.
+// The deletion may still be applied in that case.
+func (s Snapshot) DelContext(ctx context.Context, path string) error {
+	return s.conn.DelContext(ctx, path, s.Rev)
+}
+
+// Update checks if the specified path exists, and if so, does a (*Snapshot).CompareAndSet
+// with the passed value and the file revision at this snapshot.
 func (s Snapshot) Update(path string, val string) (Snapshot, error) {
-	exists, _, err := s.Exists(path)
+	exists, filerev, err := s.Exists(path)
 	if err != nil {
 		return s, err
 	}
 	if !exists {
 		return s, NewError(ErrNoEnt, fmt.Sprintf("path '%s' does not exist at %d", path, s.Rev))
 	}
-	return s.Set(path, val)
+	return s.CompareAndSet(path, filerev, val)
+}
+
+// CompareAndSet sets the specified path's body to the passed value, if the file is still
+// at revision rev. A rev of 0 expects the file not to exist. If the file was changed since,
+// an *Error wrapping ErrRevMismatch with the current file revision is returned.
+// Note that, as the coordinator doesn't keep revisions of deleted files, a file which was
+// deleted since rev is created again.
+func (s Snapshot) CompareAndSet(path string, rev int64, val string) (Snapshot, error) {
+	if rev < 0 {
+		return s, &Error{Err: ErrRange, Message: "rev must be >= 0", Op: "set", Path: path, Rev: rev}
+	}
+	newrev, err := s.conn.Set(path, rev, []byte(val))
+	if err != nil {
+		return s, err
+	}
+	return s.FastForward(newrev), nil
 }
 
 func (s Snapshot) createSnapshot(rev int64) Snapshotable {
@@ -126,6 +182,20 @@ func (s Snapshot) FastForward(rev int64) (ns Snapshot) {
 	return s.fastForward(s, rev).(Snapshot)
 }
 
+// At returns a snapshot at the given revision, which unlike with
+// FastForward may also be older than s. Revisions which don't exist
+// yet fail with ErrRange.
+func (s Snapshot) At(rev int64) (ns Snapshot, err error) {
+	latest, err := s.conn.Rev()
+	if err != nil {
+		return s, err
+	}
+	if rev < 1 || rev > latest {
+		return s, NewError(ErrRange, fmt.Sprintf("revision %d out of range 1-%d", rev, latest))
+	}
+	return Snapshot{rev, s.conn}, nil
+}
+
 // NOTE: This method does not check whether or not the scale target exists.
 // A scale of `0` will be returned if any of the path components are missing.
 // This is to avoid having to set the /apps/<app>/revs/<rev>/scale/<proc> paths to 0
@@ -212,7 +282,7 @@ func GetLatest(s Snapshot, path string, codec Codec) (file *File, err error) {
 		return
 	}
 
-	file = &File{Path: path, Value: value, Codec: codec, Snapshot: s.FastForward(rev)}
+	file = &File{Path: path, Value: value, FileRev: rev, Codec: codec, Snapshot: s.FastForward(rev)}
 
 	return
 }
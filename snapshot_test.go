@@ -10,7 +10,7 @@ import (
 )
 
 func snapshotSetup() (s Snapshot) {
-	s, err := Dial(DEFAULT_ADDR, "/snapshot-test")
+	s, err := testDial("/snapshot-test")
 	if err != nil {
 		panic(err)
 	}
@@ -176,3 +176,60 @@ func TestSnapshotGetAndSetScale(t *testing.T) {
 		t.Errorf("expected scale to be 0")
 	}
 }
+
+func TestSnapshotCompareAndSet(t *testing.T) {
+	s := snapshotSetup()
+	k := "key"
+
+	s1, err := s.CompareAndSet(k, 0, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, filerev, err := s1.Get(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s2, err := s1.CompareAndSet(k, filerev, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// filerev is stale now
+	_, err = s2.CompareAndSet(k, filerev, "c")
+	if !IsErrRevMismatch(err) {
+		t.Fatalf("expected ErrRevMismatch, got %v", err)
+	}
+	if e := err.(*Error); e.FileRev != s2.Rev {
+		t.Errorf("expected current file rev %d in error, got %d", s2.Rev, e.FileRev)
+	}
+
+	_, err = s2.CompareAndSet(k, 0, "d")
+	if !IsErrRevMismatch(err) {
+		t.Errorf("expected ErrRevMismatch for existing file, got %v", err)
+	}
+
+	val, _, _ := s2.FastForward(-1).Get(k)
+	if val != "b" {
+		t.Errorf("expected 'b', got '%s'", val)
+	}
+}
+
+func TestSnapshotUpdateRevMismatch(t *testing.T) {
+	s := snapshotSetup()
+	k := "key"
+
+	s1, err := s.Set(k, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s1.Set(k, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s1.Update(k, "c")
+	if !IsErrRevMismatch(err) {
+		t.Errorf("expected ErrRevMismatch, got %v", err)
+	}
+}
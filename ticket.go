@@ -6,10 +6,13 @@
 package visor
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/soundcloud/doozer"
 	"net"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -23,9 +26,21 @@ type Ticket struct {
 	RevisionName string
 	ProcessName  ProcessName
 	Op           OperationType
+	InstanceId   string // Instance targeted by OpRestart, OpSignal and OpDrain
+	Signal       string // Signal sent by OpSignal, such as "HUP"
 	Addr         net.TCPAddr
 	Status       TicketStatus
-	source       *doozer.Event
+	Placement    *Placement // Hosts allowed to claim the ticket, nil for any
+	Lease        time.Time  // Deadline of the current claim, zero if there is none
+	Requeues     int        // Number of times the ticket was requeued by SweepTickets
+	RetryAt      time.Time  // When a ticket with status TicketStatusRetry is requeued
+	Finished     time.Time  // When the ticket became done or dead, zero before
+	MaxAttempts  int        // Attempts before the ticket is dead, 0 for DEFAULT_TICKET_MAX_ATTEMPTS
+	Attempts     []Attempt
+	Timeline     []Transition  // Status changes, oldest first
+	Result       *TicketResult // Outcome reported with Done or Dead, nil before
+	attemptsBase int           // Attempts made before the ticket was last retried
+	source       *Change
 }
 
 // OperationType identifies different operations.
@@ -39,6 +54,12 @@ func NewOperationType(opStr string) OperationType {
 		op = OpStart
 	case "stop":
 		op = OpStop
+	case "restart":
+		op = OpRestart
+	case "signal":
+		op = OpSignal
+	case "drain":
+		op = OpDrain
 	default:
 		op = OpInvalid
 	}
@@ -52,18 +73,33 @@ func (op OperationType) String() string {
 		o = "start"
 	case OpStop:
 		o = "stop"
+	case OpRestart:
+		o = "restart"
+	case OpSignal:
+		o = "signal"
+	case OpDrain:
+		o = "drain"
 	case OpInvalid:
 		o = "<invalid>"
 	}
 	return o
 }
 
+// TargetsInstance reports whether the operation is performed on
+// a single instance, given by the ticket's InstanceId.
+func (op OperationType) TargetsInstance() bool {
+	return op == OpRestart || op == OpSignal || op == OpDrain
+}
+
 const TICKETS_PATH = "tickets"
 
 const (
 	OpInvalid               = -1
 	OpStart   OperationType = 0
 	OpStop                  = 1
+	OpRestart               = 2 // Restart the instance
+	OpSignal                = 3 // Send the signal to the instance
+	OpDrain                 = 4 // Stop taking traffic, then stop the instance
 )
 
 const (
@@ -71,9 +107,62 @@ const (
 	TicketStatusUnClaimed TicketStatus = "unclaimed"
 	TicketStatusDead      TicketStatus = "dead"
 	TicketStatusDone      TicketStatus = "done"
+	TicketStatusRetry     TicketStatus = "retry"
+	TicketStatusCancelled TicketStatus = "cancelled"
 )
 
-//                                                      procType        
+// Final reports whether a ticket with the status is finished,
+// that is done, dead or cancelled.
+func (s TicketStatus) Final() bool {
+	return s == TicketStatusDone || s == TicketStatusDead || s == TicketStatusCancelled
+}
+
+// TicketFilter selects tickets by their fields. Empty fields match
+// any ticket.
+type TicketFilter struct {
+	App      string
+	Revision string
+	ProcType ProcessName
+	Op       string // Name of the operation, such as "start"
+	Status   TicketStatus
+}
+
+// Match reports whether the ticket matches the filter.
+func (f TicketFilter) Match(t *Ticket) bool {
+	return (f.App == "" || f.App == t.AppName) &&
+		(f.Revision == "" || f.Revision == t.RevisionName) &&
+		(f.ProcType == "" || f.ProcType == t.ProcessName) &&
+		(f.Op == "" || f.Op == t.Op.String()) &&
+		(f.Status == "" || f.Status == t.Status)
+}
+
+// Tickets returns the tickets matching the filter, ordered by id.
+func Tickets(s Snapshot, filter TicketFilter) (tickets []*Ticket, err error) {
+	tickets = []*Ticket{}
+
+	ids, err := ticketIds(s)
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		var t *Ticket
+
+		t, err = GetTicket(s, id)
+		if IsErrNoEnt(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if filter.Match(t) {
+			tickets = append(tickets, t)
+		}
+	}
+	return tickets, nil
+}
+
+// procType
 func CreateTicket(appName string, revName string, pName ProcessName, op OperationType, s Snapshot) (t *Ticket, err error) {
 	t = &Ticket{
 		Id:           -1,
@@ -88,6 +177,61 @@ func CreateTicket(appName string, revName string, pName ProcessName, op Operatio
 	return t.Create()
 }
 
+// CreatePlacedTicket is like CreateTicket, but only hosts eligible
+// under the placement can claim the ticket.
+func CreatePlacedTicket(appName string, revName string, pName ProcessName, op OperationType, p *Placement, s Snapshot) (t *Ticket, err error) {
+	t = &Ticket{
+		Id:           -1,
+		AppName:      appName,
+		RevisionName: revName,
+		ProcessName:  pName,
+		Op:           op,
+		Placement:    p,
+		Status:       TicketStatusUnClaimed,
+		Path:         Path{s, "<invalid-path>"},
+	}
+	return t.Create()
+}
+
+// CreateInstanceTicket creates a ticket for an operation on the instance,
+// such as OpRestart or OpDrain. If the instance's hostname is known, only
+// that host can claim the ticket.
+func CreateInstanceTicket(ins *Instance, op OperationType, s Snapshot) (t *Ticket, err error) {
+	if !op.TargetsInstance() || op == OpSignal {
+		return nil, NewError(ErrInvalidState, fmt.Sprintf("operation %s can't be created for an instance", op))
+	}
+	return createInstanceTicket(ins, op, "", s)
+}
+
+// CreateSignalTicket creates a ticket to send the signal to the instance,
+// like CreateInstanceTicket. Signals are given by name, with or without
+// the "SIG" prefix, or by number.
+func CreateSignalTicket(ins *Instance, signal string, s Snapshot) (t *Ticket, err error) {
+	signal = strings.TrimPrefix(strings.ToUpper(signal), "SIG")
+	if signal == "" || strings.ContainsAny(signal, " /") {
+		return nil, NewError(ErrInvalidState, fmt.Sprintf("invalid signal '%s'", signal))
+	}
+	return createInstanceTicket(ins, OpSignal, signal, s)
+}
+
+func createInstanceTicket(ins *Instance, op OperationType, signal string, s Snapshot) (t *Ticket, err error) {
+	t = &Ticket{
+		Id:           -1,
+		AppName:      ins.AppName,
+		RevisionName: ins.RevisionName,
+		ProcessName:  ins.ProcessName,
+		Op:           op,
+		InstanceId:   ins.Id(),
+		Signal:       signal,
+		Status:       TicketStatusUnClaimed,
+		Path:         Path{s, "<invalid-path>"},
+	}
+	if ins.Hostname != "" {
+		t.Placement = &Placement{Host: ins.Hostname}
+	}
+	return t.Create()
+}
+
 // FastForward advances the ticket in time. It returns
 // a new instance of Ticket with the supplied revision.
 func (t *Ticket) FastForward(rev int64) *Ticket {
@@ -114,6 +258,27 @@ func (t *Ticket) Create() (tt *Ticket, err error) {
 	if err != nil {
 		return
 	}
+	// The placement is written before the status, which is what watchers wait for.
+	if !t.Placement.isZero() {
+		_, err = CreateFile(t.Snapshot, t.Path.Prefix("placement"), t.Placement, new(JSONCodec))
+		if err != nil {
+			return
+		}
+	}
+	if t.MaxAttempts > 0 {
+		_, err = CreateFile(t.Snapshot, t.Path.Prefix("max-attempts"), t.MaxAttempts, new(IntCodec))
+		if err != nil {
+			return
+		}
+	}
+	created := Transition{Status: t.Status, Time: time.Now().UTC()}
+
+	_, err = CreateFile(t.Snapshot, t.Path.Prefix("timeline", "1"), created, new(JSONCodec))
+	if err != nil {
+		return
+	}
+	t.Timeline = []Transition{created}
+
 	f, err = CreateFile(t.Snapshot, t.Path.Prefix("status"), string(t.Status), new(StringCodec))
 	if err == nil {
 		t.Snapshot = t.Snapshot.FastForward(f.FileRev)
@@ -128,104 +293,269 @@ func (t *Ticket) Claims() (claims []string, err error) {
 		return
 	}
 	claims, err = t.conn.Getdir(t.Path.Prefix("claims"), rev)
-	if err, ok := err.(*doozer.Error); ok && err.Err == doozer.ErrNoEnt {
+	if IsErrNoEnt(err) {
 		claims = []string{}
 		err = nil
 	}
 	return
 }
 
-// Claim locks the Ticket to the specified host.
+// Eligible reports whether the host may claim the Ticket under its
+// placement, given the current instances and claims.
+func (t *Ticket) Eligible(host string) (ok bool, err error) {
+	reason, err := t.Placement.check(t.Snapshot.FastForward(-1), t, host)
+	return reason == "" && err == nil, err
+}
+
+// Claim locks the Ticket to the specified host, with a lease of
+// DEFAULT_TICKET_LEASE. The status and the claim are written in one
+// transaction, which fails if the status changed since it was read,
+// so exactly one of several concurrent claimers wins. The others fail
+// with ErrAlreadyClaimed. Claim fails with ErrUnauthorized if the host
+// isn't eligible under the placement.
 func (t *Ticket) Claim(host string) (*Ticket, error) {
-	status, rev, err := t.conn.Get(t.Path.Prefix("status"), nil)
+	return t.ClaimLease(host, DEFAULT_TICKET_LEASE)
+}
+
+// ClaimLease is like Claim, but with a lease of the given duration.
+// The claimer must call Renew before the lease expires, or the ticket
+// is unclaimed again by SweepTickets.
+func (t *Ticket) ClaimLease(host string, lease time.Duration) (*Ticket, error) {
+	s := t.Snapshot.FastForward(-1)
+
+	status, _, err := s.Get(t.Path.Prefix("status"))
 	if err != nil {
 		return t, err
 	}
-	if TicketStatus(status) != TicketStatusUnClaimed {
-		return t, fmt.Errorf("ticket status is '%s'", string(status))
+	switch TicketStatus(status) {
+	case TicketStatusUnClaimed:
+	case TicketStatusClaimed:
+		return t, t.claimedError(s)
+	default:
+		return t, NewError(ErrInvalidState, fmt.Sprintf("ticket status is '%s'", string(status)))
 	}
 
-	_, err = t.conn.Set(t.Path.Prefix("status"), rev, []byte(TicketStatusClaimed))
+	// The placement is checked as stored, not as it's set on t.
+	cur, err := GetTicket(s, t.Id)
 	if err != nil {
 		return t, err
 	}
-	t.Status = TicketStatusClaimed
+	reason, err := cur.Placement.check(s, cur, host)
+	if err != nil {
+		return t, err
+	}
+	if reason != "" {
+		return t, NewError(ErrUnauthorized, fmt.Sprintf("can't claim ticket: %s", reason))
+	}
+
+	now := time.Now().UTC()
+	deadline := now.Add(lease)
 
-	rev, err = t.conn.Set(t.claimPath(host), rev, []byte(time.Now().UTC().String()))
+	// The transition writes the status first, so that backends without
+	// atomic batches fail before writing the claim if another host won.
+	txn := s.Txn()
+	txn.Set(t.claimPath(host), now.String())
+	txn.Set(t.Path.Prefix("lease"), deadline.String())
+	if err = cur.addAttempt(txn, host, now); err != nil {
+		return t, err
+	}
+	tr, err := t.transition(s, txn, TicketStatusClaimed, host, now)
 	if err != nil {
 		return t, err
 	}
 
-	return t.FastForward(rev), err
+	s1, err := txn.Commit()
+	if errors.Is(err, ErrRevMismatch) {
+		if status, _, e := s.FastForward(-1).Get(t.Path.Prefix("status")); e == nil && TicketStatus(status) == TicketStatusClaimed {
+			return t, t.claimedError(s.FastForward(-1))
+		}
+	}
+	if err != nil {
+		return t, err
+	}
+	t.Status = TicketStatusClaimed
+	t.Lease = deadline
+	t.Attempts = cur.Attempts
+	t.Timeline = append(cur.Timeline, tr)
+
+	return t.FastForward(s1.Rev), nil
+}
+
+// claimedError returns the error for claiming a ticket which is
+// already claimed at the snapshot's revision.
+func (t *Ticket) claimedError(s Snapshot) error {
+	hosts, _ := fsckGetdir(s, t.Path.Prefix("claims"))
+
+	return &Error{
+		Err:     ErrAlreadyClaimed,
+		Message: fmt.Sprintf("ticket %d is already claimed by %s", t.Id, strings.Join(hosts, ", ")),
+		Op:      "claim",
+		Path:    t.Path.Prefix("status"),
+		Rev:     s.Rev,
+	}
 }
 
-// Unclaim removes the lock applied by Claim of the Ticket.
+// Unclaim removes the lock applied by Claim of the Ticket. The status
+// and the claim are changed in one transaction.
 func (t *Ticket) Unclaim(host string) (t1 *Ticket, err error) {
-	exists, _, err := t.conn.Exists(t.claimPath(host))
+	s := t.Snapshot.FastForward(-1)
+
+	exists, _, err := s.Exists(t.claimPath(host))
+	if err != nil {
+		return t, err
+	}
 	if !exists {
 		return t, ErrUnauthorized
 	}
-	status, rev, err := t.conn.Get(t.Path.Prefix("status"), nil)
+	status, _, err := s.Get(t.Path.Prefix("status"))
 	if err != nil {
 		return t, err
 	}
 	if TicketStatus(status) != TicketStatusClaimed {
-		return t, fmt.Errorf("can't unclaim ticket, status is '%s'", status)
+		return t, NewError(ErrInvalidState, fmt.Sprintf("can't unclaim ticket, status is '%s'", status))
+	}
+
+	txn := s.Txn()
+	txn.Del(t.claimPath(host))
+	if err = t.delLease(s, txn); err != nil {
+		return t, err
+	}
+	tr, err := t.transition(s, txn, TicketStatusUnClaimed, host, time.Now().UTC())
+	if err != nil {
+		return t, err
 	}
 
-	rev, err = t.conn.Set(t.Path.Prefix("status"), rev, []byte(TicketStatusUnClaimed))
+	s, err = txn.Commit()
 	if err != nil {
 		return t, err
 	}
 	t.Status = TicketStatusUnClaimed
-	t1 = t.FastForward(rev)
+	t.Timeline = append(t.Timeline, tr)
+	t.Lease = time.Time{}
+	t1 = t.FastForward(s.Rev)
 
 	return
 }
 
-// Dead marks the ticket as "dead"
-func (t *Ticket) Dead(host string) (t1 *Ticket, err error) {
-	exists, _, err := t.conn.Exists(t.claimPath(host))
-	if !exists {
-		return t, ErrUnauthorized
+// Cancel withdraws an unclaimed ticket, so that it's never claimed.
+// It fails with ErrInvalidState if the ticket isn't unclaimed, and
+// with ErrRevMismatch if it changed concurrently, for example because
+// a host claimed it.
+func (t *Ticket) Cancel() (t1 *Ticket, err error) {
+	s := t.Snapshot.FastForward(-1)
+
+	status, _, err := s.Get(t.Path.Prefix("status"))
+	if err != nil {
+		return t, err
+	}
+	if TicketStatus(status) != TicketStatusUnClaimed {
+		return t, NewError(ErrInvalidState, fmt.Sprintf("can't cancel ticket, status is '%s'", status))
+	}
+	now := time.Now().UTC()
+
+	txn := s.Txn()
+	txn.Set(t.Path.Prefix("finished"), now.String())
+	tr, err := t.transition(s, txn, TicketStatusCancelled, "", now)
+	if err != nil {
+		return t, err
 	}
 
-	rev, err := t.conn.Set(t.Path.Prefix("status"), -1, []byte(TicketStatusDead))
+	s, err = txn.Commit()
 	if err != nil {
 		return t, err
 	}
-	t.Status = TicketStatusDead
-	t1 = t.FastForward(rev)
+	t.Status = TicketStatusCancelled
+	t.Finished = now
+	t.Timeline = append(t.Timeline, tr)
+	t1 = t.FastForward(s.Rev)
 
 	return
 }
 
-// Done marks the Ticket as done/solved in the registry.
-func (t *Ticket) Done(host string) (err error) {
-	exists, rev, err := t.conn.Exists(t.claimPath(host))
+// Dead records a failed attempt of the host, with the result's message
+// as reason. The ticket is only marked "dead" once it has no attempts
+// left, see Fail, and only then the result is stored. It may be nil.
+func (t *Ticket) Dead(host string, result *TicketResult) (t1 *Ticket, err error) {
+	reason := ""
+	if result != nil {
+		reason = result.Message
+	}
+	return t.fail(host, reason, result)
+}
+
+// Done marks the Ticket as done/solved in the registry, along with
+// its result. If it's nil, the ticket is left without a result.
+func (t *Ticket) Done(host string, result *TicketResult) (err error) {
+	s := t.Snapshot.FastForward(-1)
+
+	exists, _, err := s.Exists(t.claimPath(host))
+	if err != nil {
+		return
+	}
 	if !exists {
 		return ErrUnauthorized
 	}
 
-	rev, err = t.conn.Rev()
+	now := time.Now().UTC()
+
+	txn := s.Txn()
+	txn.Set(t.Path.Prefix("finished"), now.String())
+	if err = t.setResult(s, txn, result); err != nil {
+		return
+	}
+	if err = t.delLease(s, txn); err != nil {
+		return
+	}
+	tr, err := t.transition(s, txn, TicketStatusDone, host, now)
 	if err != nil {
-		rev = t.Rev
+		return
 	}
 
-	t.conn.Set(t.Path.Prefix("status"), rev, []byte(TicketStatusDone))
-	if err == nil {
+	if _, err = txn.Commit(); err == nil {
 		t.Status = TicketStatusDone
+		t.Finished = now
+		t.Timeline = append(t.Timeline, tr)
+		t.Result = result
 	}
 	return
 }
 
 func WatchTicket(s Snapshot, listener chan *Ticket, errors chan error) {
+	WatchTicketContext(context.Background(), s, listener, errors)
+}
+
+// WatchTicketContext is like WatchTicket, but returns once ctx is done.
+// The error of a cancelled watch is only sent on errors if it's received.
+func WatchTicketContext(ctx context.Context, s Snapshot, listener chan *Ticket, errors chan error) {
+	watchTickets(ctx, s, "", listener, errors)
+}
+
+// WatchTicketFor is like WatchTicket, but only sends the tickets which
+// the host is eligible for at the time they become unclaimed.
+func WatchTicketFor(s Snapshot, host string, listener chan *Ticket, errors chan error) {
+	WatchTicketForContext(context.Background(), s, host, listener, errors)
+}
+
+// WatchTicketForContext is like WatchTicketFor, but returns once ctx is done.
+func WatchTicketForContext(ctx context.Context, s Snapshot, host string, listener chan *Ticket, errors chan error) {
+	watchTickets(ctx, s, host, listener, errors)
+}
+
+// watchTickets sends unclaimed tickets to listener. If host is set,
+// tickets the host isn't eligible for are skipped.
+func watchTickets(ctx context.Context, s Snapshot, host string, listener chan *Ticket, errors chan error) {
+	ws := s.conn.waitSession(ctx)
+	defer ws.Close()
+
 	rev := s.Rev
 
 	for {
-		ev, err := s.conn.Wait(path.Join(TICKETS_PATH, "*", "status"), rev+1)
+		ev, err := ws.Wait(path.Join(TICKETS_PATH, "*", "status"), rev+1)
 		if err != nil {
-			errors <- err
+			select {
+			case errors <- err:
+			case <-ctx.Done():
+			}
 			return
 		}
 		rev = ev.Rev
@@ -238,29 +568,65 @@ func WatchTicket(s Snapshot, listener chan *Ticket, errors chan error) {
 		if err != nil {
 			continue
 		}
-		listener <- ticket
+		if host != "" {
+			reason, err := ticket.Placement.check(ticket.Snapshot, ticket, host)
+			if err != nil || reason != "" {
+				continue
+			}
+		}
+
+		select {
+		case listener <- ticket:
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
 func WaitTicketProcessed(s Snapshot, id int64) (status TicketStatus, s1 Snapshot, err error) {
-	var ev doozer.Event
+	return WaitTicketProcessedContext(context.Background(), s, id)
+}
+
+// WaitTicketProcessedContext is like WaitTicketProcessed, but returns
+// ctx.Err() once ctx is done.
+//
+// The returned snapshot is at the revision of the final timeline entry,
+// which is the last write of the transition, so it includes the result
+// and all other files written along with the status.
+func WaitTicketProcessedContext(ctx context.Context, s Snapshot, id int64) (status TicketStatus, s1 Snapshot, err error) {
+	var ev Change
 
+	ws := s.conn.waitSession(ctx)
+	defer ws.Close()
+
+	dir := fmt.Sprintf("/%s/%d", TICKETS_PATH, id)
 	rev := s.Rev
 
 	for {
-		ev, err = s.conn.Wait(fmt.Sprintf("/%s/%d/status", TICKETS_PATH, id), rev+1)
+		ev, err = ws.Wait(dir+"/**", rev+1)
 		if err != nil {
 			return
 		}
 		rev = ev.Rev
 
-		if ev.IsSet() && TicketStatus(ev.Body) == TicketStatusDone {
-			status = TicketStatusDone
-			break
+		if !ev.IsSet() {
+			continue
 		}
-		if ev.IsSet() && TicketStatus(ev.Body) == TicketStatusDead {
-			status = TicketStatusDead
-			break
+		if path.Dir(ev.Path) == dir+"/timeline" {
+			var tr Transition
+
+			if json.Unmarshal(ev.Body, &tr) == nil && tr.Status.Final() {
+				status = tr.Status
+				break
+			}
+		}
+		// Tickets created before timelines were recorded only get a status.
+		if ev.Path == dir+"/status" && TicketStatus(ev.Body).Final() {
+			exists, _, e := s.FastForward(rev).Exists(path.Join(dir, "timeline"))
+			if e == nil && !exists {
+				status = TicketStatus(ev.Body)
+				break
+			}
 		}
 	}
 	s1 = s.FastForward(rev)
@@ -268,20 +634,34 @@ func WaitTicketProcessed(s Snapshot, id int64) (status TicketStatus, s1 Snapshot
 	return
 }
 
-func parseTicket(snapshot Snapshot, ev *doozer.Event, body []byte) (t *Ticket, err error) {
+func parseTicket(snapshot Snapshot, ev *Change, body []byte) (t *Ticket, err error) {
 	idStr := strings.Split(ev.Path, "/")[2]
 	id, err := strconv.ParseInt(idStr, 0, 64)
 	if err != nil {
 		return nil, fmt.Errorf("ticket id %s can't be parsed as an int64", idStr)
 	}
 
-	p := path.Join(TICKETS_PATH, idStr)
+	t, err = GetTicket(snapshot, id)
+	if err != nil {
+		return
+	}
+	t.source = ev
+
+	return
+}
+
+// GetTicket fetches the ticket with the given id.
+func GetTicket(s Snapshot, id int64) (t *Ticket, err error) {
+	p := path.Join(TICKETS_PATH, strconv.FormatInt(id, 10))
 
-	f, err := Get(snapshot, path.Join(p, "op"), new(ListCodec))
+	f, err := Get(s, path.Join(p, "op"), new(ListCodec))
 	if err != nil {
-		return t, err
+		return nil, err
 	}
 	data := f.Value.([]string)
+	if len(data) < 4 {
+		return nil, NewError(ErrInvalidState, fmt.Sprintf("invalid op of ticket %d: '%s'", id, strings.Join(data, " ")))
+	}
 
 	t = &Ticket{
 		Id:           id,
@@ -289,9 +669,69 @@ func parseTicket(snapshot Snapshot, ev *doozer.Event, body []byte) (t *Ticket, e
 		RevisionName: data[1],
 		ProcessName:  ProcessName(data[2]),
 		Op:           NewOperationType(data[3]),
-		Path:         Path{snapshot, p},
-		source:       ev}
-	return t, err
+		Path:         Path{s, p},
+	}
+	if len(data) > 4 {
+		t.InstanceId = data[4]
+	}
+	if len(data) > 5 {
+		t.Signal = data[5]
+	}
+
+	status, _, err := s.Get(t.Path.Prefix("status"))
+	if err != nil && !IsErrNoEnt(err) {
+		return nil, err
+	}
+	t.Status = TicketStatus(status)
+
+	if t.Placement, err = getPlacement(s, p); err != nil {
+		return nil, err
+	}
+	if t.Lease, err = t.getTime("lease"); err != nil {
+		return nil, err
+	}
+	if t.RetryAt, err = t.getTime("retry-at"); err != nil {
+		return nil, err
+	}
+	if t.Finished, err = t.getTime("finished"); err != nil {
+		return nil, err
+	}
+	if t.Requeues, err = t.getInt("requeues"); err != nil {
+		return nil, err
+	}
+	if t.MaxAttempts, err = t.getInt("max-attempts"); err != nil {
+		return nil, err
+	}
+	if t.attemptsBase, err = t.getInt("attempts-base"); err != nil {
+		return nil, err
+	}
+	if t.Attempts, err = t.getAttempts(); err != nil {
+		return nil, err
+	}
+	if t.Timeline, err = t.getTimeline(); err != nil {
+		return nil, err
+	}
+	if t.Result, err = t.getResult(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ticketIds returns the ids of all tickets in ascending order.
+func ticketIds(s Snapshot) (ids []int64, err error) {
+	names, err := fsckGetdir(s, TICKETS_PATH)
+	if err != nil {
+		return
+	}
+	ids = []int64{}
+	for _, name := range names {
+		if id, e := strconv.ParseInt(name, 10, 64); e == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(int64s(ids))
+
+	return
 }
 
 func (t *Ticket) claimPath(host string) string {
@@ -299,15 +739,34 @@ func (t *Ticket) claimPath(host string) string {
 }
 
 func (t *Ticket) Fields() string {
-	return fmt.Sprintf("%d %s %s %s %s", t.Id, t.AppName, t.RevisionName, string(t.ProcessName), t.Op.String())
+	fields := fmt.Sprintf("%d %s %s %s %s", t.Id, t.AppName, t.RevisionName, string(t.ProcessName), t.Op.String())
+	if t.Op.TargetsInstance() {
+		fields += " " + t.InstanceId
+	}
+	if t.Op == OpSignal {
+		fields += " " + t.Signal
+	}
+	return fields
 }
 
+// Array returns the fields stored in the op file. Operations on an
+// instance add its id, OpSignal adds the signal after it.
 func (t *Ticket) Array() []string {
-	return []string{t.AppName, t.RevisionName, string(t.ProcessName), t.Op.String()}
+	a := []string{t.AppName, t.RevisionName, string(t.ProcessName), t.Op.String()}
+	if t.Op.TargetsInstance() {
+		a = append(a, t.InstanceId)
+	}
+	if t.Op == OpSignal {
+		a = append(a, t.Signal)
+	}
+	return a
 }
 
 // String returns the Go-syntax representation of Ticket.
 func (t *Ticket) String() string {
+	if t.Op.TargetsInstance() {
+		return fmt.Sprintf("Ticket{id: %d, op: %s, app: %s, rev: %s, proc: %s, instance: %s}", t.Id, t.Op.String(), t.AppName, t.RevisionName, t.ProcessName, t.InstanceId)
+	}
 	return fmt.Sprintf("Ticket{id: %d, op: %s, app: %s, rev: %s, proc: %s}", t.Id, t.Op.String(), t.AppName, t.RevisionName, t.ProcessName)
 }
 
@@ -315,3 +774,54 @@ func (t *Ticket) String() string {
 func (t *Ticket) IdString() string {
 	return fmt.Sprintf("TICKET[%d]", t.Id)
 }
+
+// getInt reads an int file of the ticket, which defaults to 0.
+func (t *Ticket) getInt(key string) (n int, err error) {
+	f, err := Get(t.Snapshot, t.Path.Prefix(key), new(IntCodec))
+	if IsErrNoEnt(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return
+	}
+	return f.Value.(int), nil
+}
+
+// getTime reads a time file of the ticket, which defaults to the zero time.
+func (t *Ticket) getTime(key string) (v time.Time, err error) {
+	value, _, err := t.Get(key)
+	if IsErrNoEnt(err) {
+		return v, nil
+	}
+	if err != nil {
+		return
+	}
+	return time.Parse(timeLayout, value)
+}
+
+// getSeq calls fn with the files in the directory key of the ticket,
+// which are named by sequence number, in order.
+func (t *Ticket) getSeq(key string, fn func(n int, value []byte) error) error {
+	names, err := fsckGetdir(t.Snapshot, t.Path.Prefix(key))
+	if err != nil {
+		return err
+	}
+	numbers := []int{}
+	for _, name := range names {
+		if n, e := strconv.Atoi(name); e == nil {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+
+	for _, n := range numbers {
+		value, _, err := t.Snapshot.GetBytes(t.Path.Prefix(key, strconv.Itoa(n)))
+		if err != nil {
+			return err
+		}
+		if err = fn(n, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,15 +6,18 @@
 package visor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"runtime"
 	"strconv"
 	"testing"
 	"time"
 )
 
 func ticketSetup() (s Snapshot, hostname string) {
-	s, err := Dial(DEFAULT_ADDR, "/ticket-test")
+	s, err := testDial("/ticket-test")
 	if err != nil {
 		panic(err)
 	}
@@ -114,6 +117,93 @@ func TestTicketClaim(t *testing.T) {
 	}
 }
 
+func TestTicketClaimConcurrent(t *testing.T) {
+	s, _ := ticketSetup()
+	n := 10
+
+	ticket, err := CreateTicket("claim", "abcd123", "test", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		go func(host string) {
+			_, err := ticket.Claim(host)
+			errs <- err
+		}(fmt.Sprintf("host-%d", i))
+	}
+
+	won := 0
+	for i := 0; i < n; i++ {
+		err := <-errs
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, ErrAlreadyClaimed):
+			t.Errorf("expected ErrAlreadyClaimed, got %v", err)
+		}
+	}
+	if won != 1 {
+		t.Errorf("expected exactly one claim to succeed, %d did", won)
+	}
+
+	claims, err := ticket.Claims()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims) != 1 {
+		t.Errorf("expected exactly one claim, got %v", claims)
+	}
+}
+
+func TestTicketClaimAlreadyClaimed(t *testing.T) {
+	s, host := ticketSetup()
+
+	ticket, err := CreateTicket("claim", "abcd123", "test", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ticket.Claim(host); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ticket.Claim("other-host")
+	if !errors.Is(err, ErrAlreadyClaimed) {
+		t.Errorf("expected ErrAlreadyClaimed, got %v", err)
+	}
+}
+
+func TestTicketClaimAfterUnclaim(t *testing.T) {
+	s, _ := ticketSetup()
+
+	ticket, err := CreateTicket("claim", "abcd123", "test", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket, err = ticket.Claim("host-a"); err != nil {
+		t.Fatal(err)
+	}
+	if ticket, err = ticket.Unclaim("host-a"); err != nil {
+		t.Fatal(err)
+	}
+	if ticket, err = ticket.Claim("host-b"); err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ticket.Claims()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims) != 1 || claims[0] != "host-b" {
+		t.Errorf("expected claim of host-b only, got %v", claims)
+	}
+	if err = ticket.Done("host-a", nil); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized for former claimer, got %v", err)
+	}
+}
+
 func TestTicketUnclaim(t *testing.T) {
 	s, host := ticketSetup()
 	id := s.Rev
@@ -172,7 +262,7 @@ func TestTicketDone(t *testing.T) {
 	}
 	ticket.Snapshot = ticket.Snapshot.FastForward(rev)
 
-	err = ticket.Done(host)
+	err = ticket.Done(host, nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -197,7 +287,7 @@ func TestTicketDoneWithWrongLock(t *testing.T) {
 	}
 	ticket.Snapshot = ticket.Snapshot.FastForward(-1)
 
-	err = ticket.Done("foo.bar.local")
+	err = ticket.Done("foo.bar.local", nil)
 	if err != ErrUnauthorized {
 		t.Error("ticket resolved with wrong lock")
 	}
@@ -255,7 +345,7 @@ func TestTicketWaitTicketProcessed(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
-		ticket.Done(host)
+		ticket.Done(host, nil)
 		if err != nil {
 			t.Error(err)
 		}
@@ -273,6 +363,323 @@ func TestTicketWaitTicketProcessed(t *testing.T) {
 	}
 }
 
+func TestTicketWaitTicketProcessedResult(t *testing.T) {
+	s, host := ticketSetup()
+
+	ticket, err := CreateTicket("lol", "cat", "app", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err = ticket.Claim(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := ticket.Done(host, &TicketResult{Message: "started", InstanceId: "lol-cat-app-1"}); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	status, s1, err := WaitTicketProcessed(ticket.Snapshot, ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != TicketStatusDone {
+		t.Fatalf("expected status done, got %s", status)
+	}
+
+	ticket, err = GetTicket(s1, ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := ticket.Result; r == nil || r.Message != "started" || r.InstanceId != "lol-cat-app-1" {
+		t.Errorf("expected result at the returned snapshot, got %#v", r)
+	}
+	if ticket.Finished.IsZero() {
+		t.Error("expected finish time at the returned snapshot")
+	}
+	if tr := ticket.Timeline[len(ticket.Timeline)-1]; tr.Status != TicketStatusDone || tr.Host != host {
+		t.Errorf("expected last transition to be done by %s, got %#v", host, tr)
+	}
+}
+
+func TestTicketWaitTicketProcessedWithoutTimeline(t *testing.T) {
+	s, _ := ticketSetup()
+	p := fmt.Sprintf("tickets/%d", s.Rev)
+
+	rev, err := s.conn.Set(p+"/status", s.Rev, []byte(TicketStatusUnClaimed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if _, err := s.conn.Set(p+"/status", rev, []byte(TicketStatusDead)); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	status, _, err := WaitTicketProcessed(s.FastForward(rev), s.Rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != TicketStatusDead {
+		t.Errorf("expected status dead, got %s", status)
+	}
+}
+
+func TestTicketWaitTicketProcessedContext(t *testing.T) {
+	s, _ := ticketSetup()
+	n := runtime.NumGoroutine()
+
+	ticket, err := CreateTicket("lol", "cat", "app", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, _, err = WaitTicketProcessedContext(ctx, ticket.Snapshot, ticket.Id)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	expectGoroutines(n, t)
+}
+
+func TestTicketCancel(t *testing.T) {
+	s, host := ticketSetup()
+
+	ticket, err := CreateTicket("lol", "cat", "app", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err = ticket.Cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Status != TicketStatusCancelled || !ticket.Status.Final() {
+		t.Errorf("expected status cancelled, got %s", ticket.Status)
+	}
+
+	ticket, err = GetTicket(ticket.Snapshot, ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Status != TicketStatusCancelled || ticket.Finished.IsZero() {
+		t.Errorf("expected cancelled and finished ticket, got %s at %s", ticket.Status, ticket.Finished)
+	}
+	if tr := ticket.Timeline[len(ticket.Timeline)-1]; tr.Status != TicketStatusCancelled {
+		t.Errorf("expected last transition to be cancelled, got %#v", tr)
+	}
+
+	if _, err = ticket.Claim(host); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState claiming a cancelled ticket, got %v", err)
+	}
+	if _, err = ticket.Cancel(); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState cancelling twice, got %v", err)
+	}
+}
+
+func TestTicketCancelClaimed(t *testing.T) {
+	s, host := ticketSetup()
+
+	ticket, err := CreateTicket("lol", "cat", "app", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ticket.Claim(host); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ticket.Cancel(); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState, got %v", err)
+	}
+}
+
+func TestTicketWaitTicketProcessedCancelled(t *testing.T) {
+	s, _ := ticketSetup()
+
+	ticket, err := CreateTicket("lol", "cat", "app", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if _, err := ticket.Cancel(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	status, _, err := WaitTicketProcessed(ticket.Snapshot, ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != TicketStatusCancelled {
+		t.Errorf("expected status cancelled, got %s", status)
+	}
+}
+
+func TestTicketTickets(t *testing.T) {
+	s, host := ticketSetup()
+
+	t1, err := CreateTicket("lol", "cat", "web", OpStart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2, err := CreateTicket("lol", "dog", "web", OpStop, t1.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t3, err := CreateTicket("rofl", "cat", "worker", OpStart, t2.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = t3.Claim(host); err != nil {
+		t.Fatal(err)
+	}
+	s = s.FastForward(-1)
+
+	for _, c := range []struct {
+		filter TicketFilter
+		ids    []int64
+	}{
+		{TicketFilter{}, []int64{t1.Id, t2.Id, t3.Id}},
+		{TicketFilter{App: "lol"}, []int64{t1.Id, t2.Id}},
+		{TicketFilter{Revision: "cat"}, []int64{t1.Id, t3.Id}},
+		{TicketFilter{ProcType: "worker"}, []int64{t3.Id}},
+		{TicketFilter{Op: "stop"}, []int64{t2.Id}},
+		{TicketFilter{Status: TicketStatusClaimed}, []int64{t3.Id}},
+		{TicketFilter{App: "lol", Op: "start", Status: TicketStatusUnClaimed}, []int64{t1.Id}},
+		{TicketFilter{App: "nope"}, []int64{}},
+	} {
+		tickets, err := Tickets(s, c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int64{}
+		for _, ticket := range tickets {
+			ids = append(ids, ticket.Id)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(c.ids) {
+			t.Errorf("expected %v for %#v, got %v", c.ids, c.filter, ids)
+		}
+	}
+}
+
+func TestTicketWatchContextCancel(t *testing.T) {
+	s, _ := ticketSetup()
+	n := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := make(chan *Ticket)
+	done := make(chan bool)
+
+	go func() {
+		WatchTicketContext(ctx, s, l, make(chan error))
+		done <- true
+	}()
+
+	// Nobody reads from l, the watch blocks sending the ticket.
+	_, err := CreateTicket("lol", "cat", "app", OpStart, s)
+	if err != nil {
+		t.Error(err)
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("watch didn't return after cancel")
+	}
+	expectGoroutines(n, t)
+}
+
+func TestTicketOperationType(t *testing.T) {
+	for _, op := range []OperationType{OpStart, OpStop, OpRestart, OpSignal, OpDrain} {
+		if NewOperationType(op.String()) != op {
+			t.Errorf("expected %s to round-trip", op)
+		}
+	}
+	if NewOperationType("reboot") != OpInvalid {
+		t.Error("expected unknown operation to be invalid")
+	}
+}
+
+func TestTicketInstanceOps(t *testing.T) {
+	s, _ := ticketSetup()
+
+	ins, err := NewInstance("web", "abc", "ops", "10.0.0.1:8000", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins.Hostname = "box-a"
+
+	restart, err := CreateInstanceTicket(ins, OpRestart, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signal, err := CreateSignalTicket(ins, "sighup", restart.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drain, err := CreateInstanceTicket(ins, OpDrain, signal.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []*Ticket{restart, signal, drain} {
+		ticket, err := GetTicket(drain.Snapshot, expected.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ticket.Op != expected.Op || ticket.InstanceId != "10-0-0-1-8000" || ticket.Signal != expected.Signal {
+			t.Errorf("expected %s, got %s", expected.Fields(), ticket.Fields())
+		}
+		if ticket.Placement == nil || ticket.Placement.Host != "box-a" {
+			t.Errorf("expected ticket to be placed on box-a, got %#v", ticket.Placement)
+		}
+	}
+	if signal.Signal != "HUP" {
+		t.Errorf("expected signal HUP, got %s", signal.Signal)
+	}
+
+	if _, err = CreateInstanceTicket(ins, OpStart, s); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState for start, got %v", err)
+	}
+	if _, err = CreateInstanceTicket(ins, OpSignal, s); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState for signal without a signal, got %v", err)
+	}
+	if _, err = CreateSignalTicket(ins, "", s); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState for empty signal, got %v", err)
+	}
+}
+
+func TestTicketWatchSignal(t *testing.T) {
+	s, _ := ticketSetup()
+	l := make(chan *Ticket)
+
+	ins, err := NewInstance("web", "abc", "ops", "10.0.0.1:8000", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go WatchTicket(s, l, make(chan error))
+
+	if _, err = CreateSignalTicket(ins, "USR1", s); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ticket := <-l:
+		if ticket.Op != OpSignal || ticket.Signal != "USR1" || ticket.InstanceId != ins.Id() {
+			t.Errorf("received unexpected ticket: %s", ticket.Fields())
+		}
+	case <-time.After(time.Second):
+		t.Error("expected ticket, got timeout")
+	}
+}
+
 func expectTicket(appName, revName, pName string, op OperationType, l chan *Ticket, t *testing.T) {
 	for {
 		select {
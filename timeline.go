@@ -0,0 +1,119 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Transition is a change of a ticket's status. Host is the host which
+// changed it, empty for changes made by tools such as SweepTickets.
+type Transition struct {
+	Status TicketStatus `json:"status"`
+	Time   time.Time    `json:"time"`
+	Host   string       `json:"host,omitempty"`
+}
+
+// TicketResult is the outcome of a ticket reported with Done or Dead.
+type TicketResult struct {
+	Message    string `json:"message,omitempty"`
+	ExitCode   *int   `json:"exit-code,omitempty"`
+	InstanceId string `json:"instance-id,omitempty"` // Instance started or affected by the ticket
+}
+
+// TimeIn returns how long the ticket spent with the given status,
+// up to now if it still has it.
+func (t *Ticket) TimeIn(status TicketStatus) (d time.Duration) {
+	for i, tr := range t.Timeline {
+		if tr.Status != status {
+			continue
+		}
+		end := time.Now()
+		if i+1 < len(t.Timeline) {
+			end = t.Timeline[i+1].Time
+		}
+		d += end.Sub(tr.Time)
+	}
+	return
+}
+
+// transition adds the change of the status to txn, along with its
+// entry in the timeline at the snapshot's revision. It must be the
+// last addition to txn: the status is written before all other files,
+// so that backends without atomic batches fail early if the ticket
+// changed concurrently, and the timeline entry after them, so that
+// its revision is the one of the whole transaction.
+func (t *Ticket) transition(s Snapshot, txn *Txn, status TicketStatus, host string, now time.Time) (tr Transition, err error) {
+	names, err := fsckGetdir(s, t.Path.Prefix("timeline"))
+	if err != nil {
+		return
+	}
+	tr = Transition{Status: status, Time: now, Host: host}
+
+	value, err := json.Marshal(tr)
+	if err != nil {
+		return
+	}
+
+	txn.setFirst(t.Path.Prefix("status"), string(status))
+	txn.SetBytes(t.Path.Prefix("timeline", strconv.Itoa(len(names)+1)), value)
+
+	return
+}
+
+// setResult adds the write of the final result to txn. Without a
+// result, the one the ticket has at the snapshot's revision is deleted.
+func (t *Ticket) setResult(s Snapshot, txn *Txn, result *TicketResult) error {
+	if result == nil {
+		exists, _, err := s.Exists(t.Path.Prefix("result"))
+		if err == nil && exists {
+			txn.Del(t.Path.Prefix("result"))
+		}
+		return err
+	}
+	value, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	txn.SetBytes(t.Path.Prefix("result"), value)
+
+	return nil
+}
+
+func (t *Ticket) getResult() (result *TicketResult, err error) {
+	value, _, err := t.Snapshot.GetBytes(t.Path.Prefix("result"))
+	if IsErrNoEnt(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+
+	result = &TicketResult{}
+	if err = json.Unmarshal(value, result); err != nil {
+		return nil, NewError(ErrInvalidState, fmt.Sprintf("invalid result of ticket %d: %s", t.Id, err))
+	}
+	return
+}
+
+// getTimeline reads the timeline, ordered by time.
+func (t *Ticket) getTimeline() (timeline []Transition, err error) {
+	timeline = []Transition{}
+
+	err = t.getSeq("timeline", func(n int, value []byte) error {
+		var tr Transition
+
+		if e := json.Unmarshal(value, &tr); e != nil {
+			return NewError(ErrInvalidState, fmt.Sprintf("invalid transition %d of ticket %d: %s", n, t.Id, e))
+		}
+		timeline = append(timeline, tr)
+		return nil
+	})
+	return
+}
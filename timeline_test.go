@@ -0,0 +1,256 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"testing"
+	"time"
+)
+
+func timelineSetup(maxAttempts int) (t *Ticket) {
+	s, err := testDial("/timeline-test")
+	if err != nil {
+		panic(err)
+	}
+	s.conn.Del("/", s.Rev)
+
+	t = &Ticket{
+		AppName:      "timeline",
+		RevisionName: "abc",
+		ProcessName:  "web",
+		Op:           OpStart,
+		Status:       TicketStatusUnClaimed,
+		MaxAttempts:  maxAttempts,
+		Path:         Path{s.FastForward(-1), ""},
+	}
+	t, err = t.Create()
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+func TestTicketTimeline(t *testing.T) {
+	ticket := timelineSetup(0)
+
+	ticket, err := ticket.Claim("host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err = ticket.Unclaim("host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err = ticket.Claim("host-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ticket.Done("host-b", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Transition{
+		{Status: TicketStatusUnClaimed},
+		{Status: TicketStatusClaimed, Host: "host-a"},
+		{Status: TicketStatusUnClaimed, Host: "host-a"},
+		{Status: TicketStatusClaimed, Host: "host-b"},
+		{Status: TicketStatusDone, Host: "host-b"},
+	}
+	check := func(timeline []Transition) {
+		if len(timeline) != len(expected) {
+			t.Fatalf("expected %d transitions, got %#v", len(expected), timeline)
+		}
+		for i, tr := range timeline {
+			if tr.Status != expected[i].Status || tr.Host != expected[i].Host {
+				t.Errorf("expected transition %d to be %s by '%s', got %s by '%s'", i, expected[i].Status, expected[i].Host, tr.Status, tr.Host)
+			}
+			if tr.Time.IsZero() || (i > 0 && tr.Time.Before(timeline[i-1].Time)) {
+				t.Errorf("transition %d has bad time %s", i, tr.Time)
+			}
+		}
+	}
+	check(ticket.Timeline)
+
+	ticket, err = GetTicket(ticket.Snapshot.FastForward(-1), ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(ticket.Timeline)
+
+	if ticket.Result != nil {
+		t.Errorf("expected no result, got %#v", ticket.Result)
+	}
+}
+
+func TestTicketDoneResult(t *testing.T) {
+	ticket := timelineSetup(0)
+
+	ticket, err := ticket.Claim("host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := 0
+	result := &TicketResult{Message: "started", ExitCode: &code, InstanceId: "timeline-abc-web-10.0.0.1-8000"}
+
+	if err = ticket.Done("host-a", result); err != nil {
+		t.Fatal(err)
+	}
+
+	ticket, err = GetTicket(ticket.Snapshot.FastForward(-1), ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := ticket.Result
+	if r == nil {
+		t.Fatal("expected a result")
+	}
+	if r.Message != result.Message || r.ExitCode == nil || *r.ExitCode != 0 || r.InstanceId != result.InstanceId {
+		t.Errorf("expected result %#v, got %#v", result, r)
+	}
+}
+
+func TestTicketDeadResult(t *testing.T) {
+	ticket := timelineSetup(1)
+
+	ticket, err := ticket.Claim("host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := 137
+	ticket, err = ticket.Dead("host-a", &TicketResult{Message: "killed", ExitCode: &code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Status != TicketStatusDead {
+		t.Fatalf("expected status dead, got %s", ticket.Status)
+	}
+
+	ticket, err = GetTicket(ticket.Snapshot.FastForward(-1), ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := ticket.Result; r == nil || r.Message != "killed" || r.ExitCode == nil || *r.ExitCode != 137 {
+		t.Errorf("expected result with exit code 137, got %#v", r)
+	}
+	if a := ticket.LastAttempt(); a == nil || a.Reason != "killed" {
+		t.Errorf("expected attempt failed for 'killed', got %#v", a)
+	}
+	if tr := ticket.Timeline[len(ticket.Timeline)-1]; tr.Status != TicketStatusDead || tr.Host != "host-a" {
+		t.Errorf("expected last transition to be dead by host-a, got %#v", tr)
+	}
+
+	ticket, err = ticket.Retry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err = GetTicket(ticket.Snapshot.FastForward(-1), ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Result != nil {
+		t.Errorf("expected result to be dropped by retry, got %#v", ticket.Result)
+	}
+	if tr := ticket.Timeline[len(ticket.Timeline)-1]; tr.Status != TicketStatusUnClaimed || tr.Host != "" {
+		t.Errorf("expected last transition to be unclaimed, got %#v", tr)
+	}
+}
+
+func TestTicketResultAfterRetry(t *testing.T) {
+	ticket := timelineSetup(2)
+
+	ticket, err := ticket.Claim("host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err = ticket.Dead("host-a", &TicketResult{Message: "boom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Status != TicketStatusRetry || ticket.Result != nil {
+		t.Fatalf("expected retry without result, got %s with %#v", ticket.Status, ticket.Result)
+	}
+
+	ticket, err = GetTicket(ticket.Snapshot.FastForward(-1), ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Result != nil {
+		t.Errorf("expected no result while retrying, got %#v", ticket.Result)
+	}
+	if a := ticket.LastAttempt(); a == nil || a.Reason != "boom" {
+		t.Errorf("expected attempt failed for 'boom', got %#v", a)
+	}
+
+	// The backoff passed.
+	if _, err = ticket.Set("retry-at", time.Now().Add(-time.Second).UTC().String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = SweepTickets(ticket.Snapshot); err != nil {
+		t.Fatal(err)
+	}
+	ticket, err = GetTicket(ticket.Snapshot.FastForward(-1), ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket, err = ticket.Claim("host-b"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ticket.Done("host-b", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ticket, err = GetTicket(ticket.Snapshot.FastForward(-1), ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Status != TicketStatusDone || ticket.Result != nil {
+		t.Errorf("expected done without result, got %s with %#v", ticket.Status, ticket.Result)
+	}
+}
+
+func TestTicketDoneClearsResult(t *testing.T) {
+	ticket := timelineSetup(0)
+
+	ticket, err := ticket.Claim("host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A result left over by an earlier version, which stored it on retries.
+	if _, err = ticket.FastForward(-1).Set("result", `{"message":"boom"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err = ticket.Done("host-a", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ticket, err = GetTicket(ticket.Snapshot.FastForward(-1), ticket.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Result != nil {
+		t.Errorf("expected no result, got %#v", ticket.Result)
+	}
+}
+
+func TestTicketTimeIn(t *testing.T) {
+	now := time.Now()
+	ticket := &Ticket{Timeline: []Transition{
+		{Status: TicketStatusUnClaimed, Time: now.Add(-10 * time.Second)},
+		{Status: TicketStatusClaimed, Time: now.Add(-7 * time.Second)},
+		{Status: TicketStatusUnClaimed, Time: now.Add(-6 * time.Second)},
+		{Status: TicketStatusClaimed, Time: now.Add(-4 * time.Second)},
+	}}
+
+	if d := ticket.TimeIn(TicketStatusUnClaimed); d != 5*time.Second {
+		t.Errorf("expected 5s unclaimed, got %s", d)
+	}
+	if d := ticket.TimeIn(TicketStatusClaimed); d < 5*time.Second || d > 6*time.Second {
+		t.Errorf("expected about 5s claimed, got %s", d)
+	}
+	if d := ticket.TimeIn(TicketStatusDone); d != 0 {
+		t.Errorf("expected 0s done, got %s", d)
+	}
+}
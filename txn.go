@@ -0,0 +1,63 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+// Txn groups writes to the coordinator which are applied
+// all-or-nothing by (*Txn).Commit. All writes are performed
+// at the revision of the snapshot the transaction was created
+// from, so they fail if any of the files changed after it.
+type Txn struct {
+	snapshot Snapshot
+	muts     []Mutation
+}
+
+// Txn returns a new, empty transaction at this snapshot's revision.
+func (s Snapshot) Txn() *Txn {
+	return &Txn{snapshot: s}
+}
+
+// Set adds a write of val to the specified path.
+func (t *Txn) Set(path string, val string) {
+	t.SetBytes(path, []byte(val))
+}
+
+// SetBytes adds a write of val to the specified path.
+func (t *Txn) SetBytes(path string, val []byte) {
+	t.muts = append(t.muts, Mutation{Path: path, Rev: t.snapshot.Rev, Value: val})
+}
+
+// setFirst is like Set, but the write is performed
+// before all writes added so far.
+func (t *Txn) setFirst(path string, val string) {
+	m := Mutation{Path: path, Rev: t.snapshot.Rev, Value: []byte(val)}
+	t.muts = append([]Mutation{m}, t.muts...)
+}
+
+// Del adds the deletion of the file at the specified path.
+// Unlike (Snapshot).Del, directories can't be deleted this way.
+func (t *Txn) Del(path string) {
+	t.muts = append(t.muts, Mutation{Path: path, Rev: t.snapshot.Rev, Del: true})
+}
+
+// Len returns the number of writes in the transaction.
+func (t *Txn) Len() int {
+	return len(t.muts)
+}
+
+// Commit applies all writes of the transaction, or none of them if
+// one fails. It returns a snapshot of the coordinator after the
+// transaction, or the old snapshot with an error.
+func (t *Txn) Commit() (Snapshot, error) {
+	if len(t.muts) == 0 {
+		return t.snapshot, nil
+	}
+
+	rev, err := t.snapshot.conn.Batch(t.muts)
+	if err != nil {
+		return t.snapshot, err
+	}
+	return t.snapshot.FastForward(rev), nil
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2012, SoundCloud Ltd.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// Source code and contact info at http://github.com/soundcloud/visor
+
+package visor
+
+import (
+	"testing"
+)
+
+// plainBackend hides the Batch method of the backend it wraps,
+// to exercise the rollback fallback of (*Conn).Batch.
+type plainBackend struct {
+	Backend
+}
+
+func txnSetup() (s Snapshot) {
+	s, err := testDial("/txn-test")
+	if err != nil {
+		panic(err)
+	}
+	s.Del("/")
+	s = s.FastForward(-1)
+
+	return
+}
+
+func txnPlainSetup() (s Snapshot) {
+	s = txnSetup()
+	s.conn = &Conn{Addr: s.conn.Addr, Root: s.conn.Root, conn: plainBackend{s.conn.conn}}
+
+	return
+}
+
+func testTxnCommit(s Snapshot, t *testing.T) {
+	txn := s.Txn()
+	txn.Set("a", "1")
+	txn.Set("dir/b", "2")
+
+	s1, err := txn.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s1.Rev <= s.Rev {
+		t.Error("expected snapshot to advance")
+	}
+
+	for k, v := range map[string]string{"a": "1", "dir/b": "2"} {
+		val, _, err := s1.Get(k)
+		if err != nil {
+			t.Error(err)
+		}
+		if val != v {
+			t.Errorf("expected '%s' at %s, got '%s'", v, k, val)
+		}
+	}
+
+	txn = s1.Txn()
+	txn.Set("a", "3")
+	txn.Del("dir/b")
+
+	s2, err := txn.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, _, _ := s2.Get("a"); val != "3" {
+		t.Errorf("expected '3', got '%s'", val)
+	}
+	if exists, _, _ := s2.Exists("dir/b"); exists {
+		t.Error("expected dir/b to be deleted")
+	}
+}
+
+func testTxnRollback(s Snapshot, atomic bool, t *testing.T) {
+	s1, err := s.Set("a", "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, err = s1.Set("conflict", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := s1.Set("conflict", "y")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Written at s1, so the last write fails with REV_MISMATCH.
+	txn := s1.Txn()
+	txn.Set("a", "new")
+	txn.Set("new", "new")
+	txn.Set("conflict", "z")
+
+	s3, err := txn.Commit()
+	if err == nil {
+		t.Fatal("expected commit to fail")
+	}
+	if s3 != s1 {
+		t.Error("expected returned snapshot to be same on error")
+	}
+
+	if atomic {
+		rev, _ := s.conn.Rev()
+		if rev != s2.Rev {
+			t.Errorf("expected no writes after %d, latest rev is %d", s2.Rev, rev)
+		}
+	}
+	s2 = s2.FastForward(-1)
+
+	if val, _, _ := s2.Get("a"); val != "old" {
+		t.Errorf("expected 'old', got '%s'", val)
+	}
+	if exists, _, _ := s2.Exists("new"); exists {
+		t.Error("expected 'new' to be rolled back")
+	}
+	if val, _, _ := s2.Get("conflict"); val != "y" {
+		t.Errorf("expected 'y', got '%s'", val)
+	}
+}
+
+func TestTxnCommit(t *testing.T) {
+	testTxnCommit(txnSetup(), t)
+}
+
+func TestTxnCommitFallback(t *testing.T) {
+	testTxnCommit(txnPlainSetup(), t)
+}
+
+func TestTxnRollback(t *testing.T) {
+	s := txnSetup()
+	_, atomic := s.conn.conn.(BatchBackend)
+
+	testTxnRollback(s, atomic, t)
+}
+
+func TestTxnRollbackFallback(t *testing.T) {
+	testTxnRollback(txnPlainSetup(), false, t)
+}
+
+func TestTxnEmpty(t *testing.T) {
+	s := txnSetup()
+
+	s1, err := s.Txn().Commit()
+	if err != nil {
+		t.Error(err)
+	}
+	if s1 != s {
+		t.Error("expected empty commit to leave snapshot unchanged")
+	}
+}
+
+func TestTxnInstanceRegister(t *testing.T) {
+	s := txnSetup()
+
+	ins, err := NewInstance("web", "abc123", "txn-app", "127.0.0.1:9999", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changed after the instance's snapshot, the last write conflicts.
+	if _, err = s.Set(ins.ProctypePath(), "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ins.Register()
+	if err == nil {
+		t.Fatal("expected registration to fail")
+	}
+
+	if exists, _, _ := s.FastForward(-1).Exists(ins.Path.Dir); exists {
+		t.Error("expected instance not to be written")
+	}
+}
@@ -37,7 +37,6 @@ import (
 	"fmt"
 	"path"
 	"strconv"
-	"time"
 )
 
 const DEFAULT_URI string = "doozer:?ca=localhost:8046"
@@ -48,10 +47,16 @@ const START_PORT int = 8000
 const START_PORT_PATH string = "/next-port"
 const UID_PATH string = "/uid"
 
+// timeLayout is the format of the timestamps written to the coordinator,
+// as returned by (time.Time).String for UTC times.
+const timeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
 type ProcessName string
 type Stack string
 type State string
 
+// Init sets up a new coordinator tree at the current schema version.
+// Existing trees are left as they are, see Migrate to upgrade them.
 func Init(s Snapshot) (rev int64, err error) {
 	var s1 Snapshot
 
@@ -61,7 +66,11 @@ func Init(s Snapshot) (rev int64, err error) {
 	}
 
 	if !exists {
-		s1, err = s.Set(START_PORT_PATH, strconv.Itoa(START_PORT))
+		txn := s.FastForward(-1).Txn()
+		txn.Set(START_PORT_PATH, strconv.Itoa(START_PORT))
+		txn.Set(SCHEMA_PATH, strconv.Itoa(SCHEMA_VERSION))
+
+		s1, err = txn.Commit()
 		if err != nil {
 			return
 		}
@@ -71,20 +80,21 @@ func Init(s Snapshot) (rev int64, err error) {
 	return s.conn.Rev()
 }
 
+// ClaimNextPort increments the port counter and returns the claimed port. It retries
+// until it wins against concurrent claimers.
 func ClaimNextPort(s Snapshot) (port int, err error) {
 	for {
 		f, err := GetLatest(s, START_PORT_PATH, new(IntCodec))
+		if err != nil {
+			return -1, err
+		}
+		port = f.Value.(int)
+
+		_, err = f.Snapshot.CompareAndSet(START_PORT_PATH, f.FileRev, strconv.Itoa(port+1))
 		if err == nil {
-			port = f.Value.(int)
-
-			f, err = f.Set(port + 1)
-			if err == nil {
-				break
-			} else {
-				s = f.Snapshot
-				time.Sleep(time.Second / 10)
-			}
-		} else {
+			break
+		}
+		if !IsErrRevMismatch(err) {
 			return -1, err
 		}
 	}
@@ -98,12 +108,18 @@ func Scale(app string, revision string, processName string, factor int, s Snapsh
 	}
 
 	exists, _, err := s.conn.Exists(path.Join(APPS_PATH, app, REVS_PATH, revision))
-	if !exists || err != nil {
-		return fmt.Errorf("%s@%s not found", app, revision)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return NewError(ErrNoEnt, fmt.Sprintf("%s@%s not found", app, revision))
 	}
 	exists, _, err = s.conn.Exists(path.Join(APPS_PATH, app, PROCS_PATH, processName))
-	if !exists || err != nil {
-		return fmt.Errorf("proc '%s' doesn't exist", processName)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return NewError(ErrNoEnt, fmt.Sprintf("proc '%s' doesn't exist", processName))
 	}
 
 	op := OpStart
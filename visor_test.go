@@ -7,12 +7,46 @@ package visor
 
 import (
 	"fmt"
+	"os"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 const SCALE_PATH_FMT = "apps/%s/revs/%s/scale/%s"
 
+// testUri is the backend the tests run against. It defaults to a shared
+// in-memory store and can be pointed to a doozerd cluster by setting
+// VISOR_TEST_URI, e.g. VISOR_TEST_URI=doozer:?ca=localhost:8046.
+var testUri = "mem:visor-test"
+
+func init() {
+	if uri := os.Getenv("VISOR_TEST_URI"); uri != "" {
+		testUri = uri
+	}
+}
+
+func testDial(root string) (Snapshot, error) {
+	return DialUri(testUri, root)
+}
+
+// expectGoroutines fails if the number of goroutines doesn't
+// drop to n within a second.
+func expectGoroutines(n int, t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if runtime.NumGoroutine() <= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("expected %d goroutines, got %d", n, runtime.NumGoroutine())
+}
+
 func TestDialWithDefaultAddrAndRoot(t *testing.T) {
+	if !strings.HasPrefix(testUri, "doozer:") {
+		t.Skip("no doozerd configured in VISOR_TEST_URI")
+	}
 	_, err := Dial(DEFAULT_ADDR, DEFAULT_ROOT)
 	if err != nil {
 		t.Error(err)
@@ -27,7 +61,7 @@ func TestDialWithInvalidAddr(t *testing.T) {
 }
 
 func TestScaleUp(t *testing.T) {
-	s, err := Dial(DEFAULT_ADDR, "/scale-test")
+	s, err := testDial("/scale-test")
 	if err != nil {
 		panic(err)
 	}
@@ -60,7 +94,7 @@ func TestScaleUp(t *testing.T) {
 }
 
 func TestScaleDown(t *testing.T) {
-	s, err := Dial(DEFAULT_ADDR, "/scale-test")
+	s, err := testDial("/scale-test")
 	if err != nil {
 		panic(err)
 	}
@@ -101,7 +135,7 @@ func TestScaleDown(t *testing.T) {
 }
 
 func TestGetuid(t *testing.T) {
-	s, err := Dial(DEFAULT_ADDR, "/scale-test")
+	s, err := testDial("/scale-test")
 	if err != nil {
 		panic(err)
 	}
@@ -125,3 +159,48 @@ func TestGetuid(t *testing.T) {
 		<-ch
 	}
 }
+
+func TestClaimNextPort(t *testing.T) {
+	s, err := testDial("/port-test")
+	if err != nil {
+		panic(err)
+	}
+	s.Del("/")
+	s = s.FastForward(-1)
+
+	rev, err := Init(s)
+	if err != nil {
+		panic(err)
+	}
+	s = s.FastForward(rev)
+
+	ports := make(chan int)
+
+	for i := 0; i < 20; i++ {
+		go func() {
+			port, err := ClaimNextPort(s)
+			if err != nil {
+				t.Error(err)
+			}
+			ports <- port
+		}()
+	}
+
+	claimed := map[int]bool{}
+
+	for i := 0; i < 20; i++ {
+		port := <-ports
+		if claimed[port] {
+			t.Errorf("port %d claimed twice", port)
+		}
+		claimed[port] = true
+	}
+
+	f, err := GetLatest(s, START_PORT_PATH, new(IntCodec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Value.(int) != START_PORT+20 {
+		t.Errorf("expected next port %d, got %d", START_PORT+20, f.Value.(int))
+	}
+}